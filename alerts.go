@@ -0,0 +1,129 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+func showAlerts() {
+	deployments := selectDeployments(*showalertsdeployments, *showalertsallflag)
+
+	if *rawmodeflag {
+		for _, v := range deployments {
+			text, errs := composeapi.GetAlertsForDeploymentJSON(v.ID)
+			bailOnErrs(errs)
+			fmt.Fprintln(stdout, text)
+		}
+		return
+	}
+
+	allalerts := map[string]composeapi.Alerts{}
+	for _, v := range deployments {
+		alerts, errs := composeapi.GetAlertsForDeployment(v.ID)
+		bailOnErrs(errs)
+
+		if *formatflag {
+			fmt.Fprintf(stdout, "%15s: %s\n", "Deployment", v.Name)
+			printAlerts(stdout, *alerts)
+			fmt.Fprintln(stdout)
+		} else {
+			allalerts[v.Name] = *alerts
+		}
+	}
+
+	if !*formatflag {
+		printAsJSON(allalerts)
+	}
+}
+
+func setAlerts() {
+	deployment := getDeployment(*alertssetdeployment)
+
+	params := composeapi.AlertsParams{Enabled: !*alertssetdisableflag}
+
+	if *alertssetfrom != "" {
+		source := getDeployment(*alertssetfrom)
+		alerts, errs := composeapi.GetAlertsForDeployment(source.ID)
+		bailOnErrs(errs)
+		params.Channels = alerts.Channels
+	}
+
+	add := func(channeltype string, targets []string) {
+		for _, v := range targets {
+			params.Channels = append(params.Channels, composeapi.AlertChannel{Type: channeltype, Target: v})
+		}
+	}
+	add(composeapi.AlertChannelEmail, *alertssetemails)
+	add(composeapi.AlertChannelSMS, *alertssetsms)
+	add(composeapi.AlertChannelPagerDuty, *alertssetpagerduty)
+	add(composeapi.AlertChannelSlack, *alertssetslack)
+
+	if len(params.Channels) == 0 {
+		if params.Enabled {
+			log.Fatal("Must supply at least one alert channel or --from deployment")
+		}
+		// Disabling keeps the channels, so re-enabling needn't list them all
+		// again
+		current, errs := composeapi.GetAlertsForDeployment(deployment.ID)
+		bailOnErrs(errs)
+		params.Channels = current.Channels
+	}
+
+	alerts, errs := composeapi.UpdateAlertsForDeployment(deployment.ID, params)
+	bailOnErrs(errs)
+
+	if alerts.Errors.Error != "" {
+		fmt.Fprintf(stdout, "Error: %s\n", alerts.Errors.Error)
+	} else {
+		if *formatflag {
+			printAlerts(stdout, *alerts)
+		} else {
+			printAsJSON(*alerts)
+		}
+	}
+}
+
+func printAlerts(w io.Writer, alerts composeapi.Alerts) {
+	fmt.Fprintf(w, "%15s: %t\n", "Enabled", alerts.Enabled)
+	for _, v := range alerts.Channels {
+		fmt.Fprintf(w, "%15s: %s\n", v.Type, v.Target)
+	}
+	fmt.Fprintf(w, "%15s: %s\n", "Routing", alertsRouting(alerts))
+}
+
+// alertsRouting fingerprints where alerts go, so deployments with the same
+// on-call routing show the same value whatever order channels are listed in
+func alertsRouting(alerts composeapi.Alerts) string {
+	if !alerts.Enabled || len(alerts.Channels) == 0 {
+		return "none"
+	}
+
+	channels := make([]string, len(alerts.Channels))
+	for i, v := range alerts.Channels {
+		channels[i] = v.Type + ":" + v.Target
+	}
+	sort.Strings(channels)
+
+	sum := sha256.Sum256([]byte(strings.Join(channels, "\n")))
+	return fmt.Sprintf("%x", sum[:6])
+}
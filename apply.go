@@ -0,0 +1,103 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/compose/cocli/composeapi"
+	"github.com/compose/cocli/composeapi/plan"
+)
+
+func applyManifest() {
+	m, err := plan.ReadManifest(*applyfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	account, errs := composeapi.GetAccount()
+	bailOnErrs(errs)
+
+	states, errs := plan.FetchState(m.Names())
+	bailOnErrs(errs)
+	teams, errs := composeapi.GetTeams()
+	bailOnErrs(errs)
+
+	changes, errs := plan.Compute(*m, states, *teams, plan.Options{
+		AccountID:      account.ID,
+		PruneWhitelist: *applypruneflag,
+	})
+	if errs != nil {
+		for _, v := range errs {
+			log.Println(v)
+		}
+		os.Exit(1)
+	}
+
+	if len(changes) == 0 {
+		fmt.Fprintln(stdout, "No changes. Deployments match the manifest.")
+		return
+	}
+
+	printPlan(changes)
+
+	// The plan is all a dry run has to show
+	if composeapi.DryRun {
+		return
+	}
+
+	if !*applyautoapproveflag && !confirm("Apply these changes?") {
+		fmt.Fprintln(stdout, "Apply cancelled.")
+		return
+	}
+
+	executor := plan.Executor{
+		Parallelism: *applyparallelism,
+		Timeout:     *applytimeout,
+		Started: func(change plan.Change) {
+			fmt.Fprintf(stdout, "%s ...\n", change)
+		},
+	}
+	if errs := executor.Execute(changes); errs != nil {
+		for _, v := range errs {
+			log.Println(v)
+		}
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(stdout, "Apply complete: %d changes.\n", len(changes))
+}
+
+func printPlan(changes []plan.Change) {
+	for _, v := range changes {
+		fmt.Fprintln(stdout, v)
+	}
+	add, change, remove := plan.Summarize(changes)
+	fmt.Fprintf(stdout, "\nPlan: %d to add, %d to change, %d to remove.\n\n", add, change, remove)
+}
+
+// confirm asks question on the terminal and reports whether the answer was yes
+func confirm(question string) bool {
+	fmt.Fprintf(stdout, "%s Only 'yes' will be accepted: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(answer) == "yes"
+}
@@ -0,0 +1,318 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+// auditRecord is one line of the audit log
+type auditRecord struct {
+	Time         time.Time   `json:"time"`
+	UserID       string      `json:"user_id"`
+	Command      string      `json:"command"`
+	Args         []string    `json:"args"`
+	Method       string      `json:"method"`
+	Endpoint     string      `json:"endpoint"`
+	DeploymentID string      `json:"deployment_id,omitempty"`
+	Params       interface{} `json:"params,omitempty"`
+	RecipeID     string      `json:"recipe_id,omitempty"`
+	StatusCode   int         `json:"status_code"`
+	Outcome      string      `json:"outcome"`
+	Error        string      `json:"error,omitempty"`
+}
+
+// auditor appends a record to the audit log for every mutating API call
+type auditor struct {
+	mutex    sync.Mutex
+	filename string
+	command  string
+	userid   string
+}
+
+// startAudit logs mutating API calls made while running command, dry runs
+// included, returning a function which stops logging them
+func startAudit(command string) func() {
+	filename := auditFilename()
+	if filename == "" {
+		return func() {}
+	}
+
+	a := &auditor{filename: filename, command: command}
+	return composeapi.AddCallObserver(a.observeCall)
+}
+
+func auditFilename() string {
+	if *auditfile != "" {
+		return *auditfile
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".cocli", "audit.jsonl")
+}
+
+func (a *auditor) observeCall(call composeapi.Call) {
+	if call.Method == "GET" {
+		return
+	}
+
+	record := auditRecord{
+		Time:       time.Now().UTC(),
+		UserID:     a.userID(),
+		Command:    a.command,
+		Args:       redactArgs(os.Args[1:]),
+		Method:     call.Method,
+		Endpoint:   call.Path,
+		Params:     composeapi.RedactParams(call.Params),
+		StatusCode: call.StatusCode,
+		Outcome:    "success",
+	}
+
+	response := map[string]interface{}{}
+	json.Unmarshal([]byte(call.Body), &response)
+
+	record.DeploymentID = auditDeploymentID(call.Path, response)
+	record.RecipeID = auditRecipeID(response)
+
+	switch {
+	case composeapi.IsDryRun(call.Errors):
+		record.Outcome = "dry-run"
+	case call.Errors != nil:
+		record.Outcome = "error"
+		record.Error = fmt.Sprint(call.Errors)
+	case call.StatusCode >= 400:
+		record.Outcome = "error"
+		record.Error = responseError(response)
+	case responseError(response) != "":
+		record.Outcome = "error"
+		record.Error = responseError(response)
+	}
+
+	a.write(record)
+}
+
+// userID looks up the current user once, on the first mutating call
+func (a *auditor) userID() string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.userid == "" {
+		user, errs := composeapi.GetUser()
+		if errs != nil {
+			return ""
+		}
+		a.userid = user.ID
+	}
+	return a.userid
+}
+
+func (a *auditor) write(record auditRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("audit: %s", err)
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(a.filename), 0700); err != nil {
+		log.Printf("audit: %s", err)
+		return
+	}
+	file, err := os.OpenFile(a.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("audit: %s", err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Printf("audit: %s", err)
+	}
+}
+
+// secretflags are flags whose values are credentials though their names
+// don't say so
+var secretflags = map[string]bool{
+	"slack":     true,
+	"pagerduty": true,
+}
+
+// redactArgs copies command line arguments with the values of secret bearing
+// flags, and passwords in connection strings, redacted
+func redactArgs(args []string) []string {
+	redactedargs := make([]string, len(args))
+	redactnext := false
+
+	for i, v := range args {
+		switch {
+		case redactnext:
+			v = composeapi.Redacted
+			redactnext = false
+		case strings.HasPrefix(v, "--"):
+			name := strings.TrimPrefix(v, "--")
+			if eq := strings.Index(name, "="); eq >= 0 {
+				if isSecretFlag(name[:eq]) {
+					v = "--" + name[:eq] + "=" + composeapi.Redacted
+				}
+			} else {
+				redactnext = isSecretFlag(name)
+			}
+		default:
+			v = composeapi.RedactURIPasswords(v)
+		}
+		redactedargs[i] = v
+	}
+
+	return redactedargs
+}
+
+func isSecretFlag(name string) bool {
+	return secretflags[name] || composeapi.IsSecretKey(name)
+}
+
+func auditDeploymentID(path string, response map[string]interface{}) string {
+	segments := strings.Split(path, "/")
+	if len(segments) > 1 && segments[0] == "deployments" {
+		return segments[1]
+	}
+	if id, ok := response["deployment_id"].(string); ok {
+		return id
+	}
+	if _, ok := response["provision_recipe_id"]; ok {
+		if id, ok := response["id"].(string); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+func auditRecipeID(response map[string]interface{}) string {
+	if id, ok := response["provision_recipe_id"].(string); ok {
+		return id
+	}
+	if id, ok := response["recipe_id"].(string); ok {
+		return id
+	}
+	// Calls which start work return the recipe itself
+	if _, ok := response["template"]; ok {
+		if id, ok := response["id"].(string); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+func responseError(response map[string]interface{}) string {
+	switch errs := response["errors"].(type) {
+	case nil:
+		return ""
+	case map[string]interface{}:
+		var messages []string
+		for _, v := range errs {
+			if message := fmt.Sprint(v); v != nil && message != "" {
+				messages = append(messages, message)
+			}
+		}
+		return strings.Join(messages, "; ")
+	default:
+		return fmt.Sprint(errs)
+	}
+}
+
+func showAudit() {
+	file, err := os.Open(auditFilename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	var since time.Time
+	if *auditshowsince > 0 {
+		since = time.Now().Add(-*auditshowsince)
+	}
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		record := auditRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Printf("Skipping malformed audit record: %s", err)
+			continue
+		}
+		if record.Time.Before(since) ||
+			(*auditshowcommand != "" && record.Command != *auditshowcommand) ||
+			(*auditshowdeployment != "" && record.DeploymentID != *auditshowdeployment) ||
+			(*auditshowoutcome != "" && record.Outcome != *auditshowoutcome) {
+			continue
+		}
+
+		if *rawmodeflag {
+			fmt.Fprintln(stdout, scanner.Text())
+		} else {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	if *rawmodeflag {
+		return
+	}
+	if *formatflag {
+		for _, v := range records {
+			printAuditRecord(stdout, v)
+			fmt.Fprintln(stdout)
+		}
+	} else {
+		printAsJSON(records)
+	}
+}
+
+func printAuditRecord(w io.Writer, record auditRecord) {
+	fmt.Fprintf(w, "%15s: %s\n", "Time", record.Time)
+	fmt.Fprintf(w, "%15s: %s\n", "User ID", record.UserID)
+	fmt.Fprintf(w, "%15s: %s\n", "Command", record.Command)
+	fmt.Fprintf(w, "%15s: %s %s\n", "Call", record.Method, record.Endpoint)
+	if record.DeploymentID != "" {
+		fmt.Fprintf(w, "%15s: %s\n", "Deployment ID", record.DeploymentID)
+	}
+	if record.RecipeID != "" {
+		fmt.Fprintf(w, "%15s: %s\n", "Recipe ID", record.RecipeID)
+	}
+	fmt.Fprintf(w, "%15s: %s\n", "Outcome", record.Outcome)
+	if record.Error != "" {
+		fmt.Fprintf(w, "%15s: %s\n", "Error", record.Error)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+)
+
+func showCert() {
+	deployment := getDeployment(*certdeployment)
+
+	if deployment.CACertificateBase64 == "" {
+		log.Fatalf("No CA certificate for deployment %s", deployment.Name)
+	}
+
+	pemdata, cert, err := decodeCACertificate(deployment.CACertificateBase64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *certoutput == "" {
+		printCertificate(os.Stderr, cert)
+		stdout.Write(pemdata)
+		return
+	}
+
+	if err := ioutil.WriteFile(*certoutput, pemdata, 0644); err != nil {
+		log.Fatal(err)
+	}
+	printCertificate(stdout, cert)
+	fmt.Fprintf(stdout, "%15s: %s\n", "Written To", *certoutput)
+}
+
+// decodeCACertificate turns a deployment's CACertificateBase64 into PEM and
+// checks that it holds a parseable certificate
+func decodeCACertificate(cabase64 string) ([]byte, *x509.Certificate, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(cabase64))
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding CA certificate: %s", err)
+	}
+
+	der := decoded
+	if block, _ := pem.Decode(decoded); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, nil, fmt.Errorf("CA certificate is a %s PEM block", block.Type)
+		}
+		der = block.Bytes
+	} else if bytes.Contains(decoded, []byte("-----BEGIN")) {
+		return nil, nil, errors.New("CA certificate is malformed PEM")
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing CA certificate: %s", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), cert, nil
+}
+
+func printCertificate(w io.Writer, cert *x509.Certificate) {
+	fingerprint := sha256.Sum256(cert.Raw)
+	hexparts := make([]string, len(fingerprint))
+	for i, b := range fingerprint {
+		hexparts[i] = fmt.Sprintf("%02X", b)
+	}
+
+	fmt.Fprintf(w, "%15s: %s\n", "Subject", cert.Subject)
+	fmt.Fprintf(w, "%15s: %s\n", "Issuer", cert.Issuer)
+	fmt.Fprintf(w, "%15s: %s\n", "Not Before", cert.NotBefore)
+	fmt.Fprintf(w, "%15s: %s\n", "Not After", cert.NotAfter)
+	fmt.Fprintf(w, "%15s: %s\n", "SHA256", strings.Join(hexparts, ":"))
+}
+
+func showEnv() {
+	deployment := getDeployment(*envdeployment)
+
+	prefix := *envprefix
+	if prefix == "" {
+		prefix = envName(deployment.Name)
+	}
+
+	output := formatDotenv(connectionVars(*deployment, prefix, deployment.Connection.Direct), !*envdotenvflag)
+
+	if *envoutput == "" {
+		fmt.Fprint(stdout, output)
+		return
+	}
+
+	if err := ioutil.WriteFile(*envoutput, []byte(output), 0600); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// envName turns a deployment name into an environment variable prefix
+func envName(name string) string {
+	mapped := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+
+	if mapped == "" || unicode.IsDigit(rune(mapped[0])) {
+		mapped = "COMPOSE_" + mapped
+	}
+
+	return mapped
+}
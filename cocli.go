@@ -18,10 +18,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/compose/cocli/composeapi"
+	"github.com/compose/cocli/composeapi/recording"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
-	"strings"
+	"os/exec"
+	"runtime"
 )
 
 var (
@@ -30,6 +35,10 @@ var (
 	rawmodeflag = app.Flag("raw", "Output raw JSON responses").Default("false").Bool()
 	formatflag  = app.Flag("fmt", "Format output for readability").Default("false").Bool()
 	fullcaflag  = app.Flag("fullca", "Show all of CA Certificates").Default("false").Bool()
+	dryrunflag  = app.Flag("dry-run", "Print requests which would change anything instead of sending them").Default("false").Bool()
+	auditfile   = app.Flag("audit-file", "File to log mutating API calls to (default ~/.cocli/audit.jsonl)").Envar("COCLI_AUDIT_FILE").String()
+	debugflag   = app.Flag("debug", "Log API requests and responses to stderr").Envar("COCLI_DEBUG").Default("false").Bool()
+	tracefile   = app.Flag("trace-file", "File to write API requests and responses to as HAR").String()
 
 	showcmd            = app.Command("show", "Show attribute")
 	showaccountcmd     = showcmd.Command("account", "Show account details")
@@ -43,10 +52,20 @@ var (
 	showrecipesdepid          = showdeploymentrecipescmd.Arg("depid", "Deployment ID").String()
 	showversionsdepid         = showdeploymentversionscmd.Arg("depid", "Deployment ID").String()
 
+	showdeploymentuserscmd = showdeploymentcmd.Command("users", "Show deployment database users")
+	showusersdepid         = showdeploymentuserscmd.Arg("depid", "Deployment ID").String()
+
+	showdeploymentscalingscmd = showdeploymentcmd.Command("scalings", "Show deployment units allocated and used")
+	showscalingsdepid         = showdeploymentscalingscmd.Arg("depid", "Deployment ID").String()
+
 	showrecipescmd  = showcmd.Command("recipes", "Show recipes for a deployment")
 	showclusterscmd = showcmd.Command("clusters", "Show available clusters")
 	showuser        = showcmd.Command("user", "Show current associated user")
 
+	showalertscmd         = showcmd.Command("alerts", "Show deployment alert settings")
+	showalertsdeployments = showalertscmd.Arg("deployments", "Deployment IDs or names").Strings()
+	showalertsallflag     = showalertscmd.Flag("all", "Show alerts for all deployments").Default("false").Bool()
+
 	showdatacenters = showcmd.Command("datacenters", "Show available datacenters")
 	showdatabases   = showcmd.Command("databases", "Show available database types")
 
@@ -56,6 +75,129 @@ var (
 	createdeploymenttype       = createdeploymentcmd.Arg("type", "New Deployment Type").String()
 	createdeploymentcluster    = createdeploymentcmd.Flag("cluster", "Cluster ID").String()
 	createdeploymentdatacenter = createdeploymentcmd.Flag("datacenter", "Datacenter location").String()
+	createdeploymentfile       = createdeploymentcmd.Flag("file", "JSON or YAML file of deployment parameters").Short('f').ExistingFile()
+	createdeploymentversion    = createdeploymentcmd.Flag("version", "Database version").String()
+	createdeploymentunits      = createdeploymentcmd.Flag("units", "Initial units").Int()
+	createdeploymentssl        = createdeploymentcmd.Flag("ssl", "Enable SSL (--no-ssl overrides a -f file)").Action(recordFlag("ssl")).Default("false").Bool()
+	createdeploymentwiredtiger = createdeploymentcmd.Flag("wiredtiger", "Use the WiredTiger storage engine (MongoDB)").Action(recordFlag("wiredtiger")).Default("false").Bool()
+	createdeploymentcachemode  = createdeploymentcmd.Flag("cache-mode", "Run as a cache (Redis)").Action(recordFlag("cache-mode")).Default("false").Bool()
+	createdeploymentnotes      = createdeploymentcmd.Flag("notes", "Deployment notes").String()
+	createdeploymenttags       = createdeploymentcmd.Flag("tag", "Deployment tag (repeatable)").Strings()
+	createdeploymentnovalidate = createdeploymentcmd.Flag("no-validate", "Skip checking parameters against the API before creating").Default("false").Bool()
+
+	opencmd        = app.Command("open", "Open deployment in the Compose web UI")
+	opendeployment = opencmd.Arg("deployment", "Deployment ID or name").Required().String()
+	openprintflag  = opencmd.Flag("print", "Print the URL rather than launching a browser").Default("false").Bool()
+
+	connectcmd         = app.Command("connect", "Connect to a deployment with its native database shell")
+	connectdeployment  = connectcmd.Arg("deployment", "Deployment ID or name").Required().String()
+	connectpasswordenv = connectcmd.Flag("password-env", "Environment variable holding the database password").Default("COMPOSEDBPASSWORD").String()
+	connectprintflag   = connectcmd.Flag("print", "Print the command, with the password masked, rather than running it (saves the CA certificate to ~/.cocli/certs)").Default("false").Bool()
+
+	certcmd        = app.Command("cert", "Export a deployment's CA certificate as PEM")
+	certdeployment = certcmd.Arg("deployment", "Deployment ID or name").Required().String()
+	certoutput     = certcmd.Flag("output", "File to write the PEM certificate to").Short('o').String()
+
+	envcmd        = app.Command("env", "Show a deployment's connection strings as environment variables")
+	envdeployment = envcmd.Arg("deployment", "Deployment ID or name").Required().String()
+	envprefix     = envcmd.Flag("prefix", "Variable name prefix (defaults to the deployment name)").String()
+	envdotenvflag = envcmd.Flag("dotenv", "Omit export for use as a .env file").Default("false").Bool()
+	envoutput     = envcmd.Flag("output", "File to write the variables to").Short('o').String()
+
+	exportcmd                    = app.Command("export", "Export...")
+	exportconnectioncmd          = exportcmd.Command("connection", "Export connection configuration for applications")
+	exportconnectiondeployment   = exportconnectioncmd.Arg("deployment", "Deployment ID or name").Required().String()
+	exportconnectionformat       = exportconnectioncmd.Flag("format", "Output format").Default("json").Enum("k8s-secret", "dotenv", "docker-compose", "json")
+	exportconnectionmaskflag     = exportconnectioncmd.Flag("mask", "Mask passwords in connection strings").Default("false").Bool()
+	exportconnectionpasswordenv  = exportconnectioncmd.Flag("password-env", "Environment variable holding the database password").String()
+	exportconnectionpasswordfile = exportconnectioncmd.Flag("password-file", "File holding the database password").String()
+	exportconnectionprefix       = exportconnectioncmd.Flag("prefix", "Variable name prefix (defaults to the deployment name)").String()
+	exportconnectionname         = exportconnectioncmd.Flag("name", "Kubernetes Secret name (defaults to the deployment name)").String()
+	exportconnectionnamespace    = exportconnectioncmd.Flag("namespace", "Kubernetes namespace").String()
+	exportconnectionservice      = exportconnectioncmd.Flag("service", "docker-compose service name").Default("app").String()
+	exportconnectionoutput       = exportconnectioncmd.Flag("output", "File to write the configuration to").Short('o').String()
+
+	exportmanifestcmd         = exportcmd.Command("manifest", "Export deployments as a manifest for apply (without datacenter or cluster_id, which the API doesn't report)")
+	exportmanifestdeployments = exportmanifestcmd.Arg("deployments", "Deployment IDs or names (defaults to all)").Strings()
+	exportmanifestoutput      = exportmanifestcmd.Flag("output", "File to write the manifest to").Short('o').String()
+
+	synccmd              = app.Command("sync", "Sync...")
+	synck8scmd           = synccmd.Command("k8s", "Sync deployment connection Secrets, and optionally ConfigMaps, to Kubernetes")
+	synck8sdeployments   = synck8scmd.Arg("deployments", "Deployment IDs or names").Strings()
+	synck8sallflag       = synck8scmd.Flag("all", "Sync all deployments").Default("false").Bool()
+	synck8snamespace     = synck8scmd.Flag("namespace", "Kubernetes namespace").String()
+	synck8spasswordenv   = synck8scmd.Flag("password-env", "Environment variable holding the database password").String()
+	synck8spasswordfile  = synck8scmd.Flag("password-file", "File holding the database password").String()
+	synck8soutputdir     = synck8scmd.Flag("output-dir", "Directory to write one manifest per Secret or ConfigMap to").String()
+	synck8sapplyflag     = synck8scmd.Flag("apply", "Apply the Secrets and ConfigMaps to the Kubernetes API server").Default("false").Bool()
+	synck8sconfigmapflag = synck8scmd.Flag("configmap", "Also sync a ConfigMap of each deployment's hosts and CA certificate").Default("false").Bool()
+	synck8skubeconfig    = synck8scmd.Flag("kubeconfig", "Path to kubeconfig (defaults to $KUBECONFIG or ~/.kube/config)").String()
+	synck8scontext       = synck8scmd.Flag("context", "kubeconfig context (defaults to current-context)").String()
+
+	rotatecmd            = app.Command("rotate", "Rotate...")
+	rotatecredentialscmd = rotatecmd.Command("credentials", "Change a deployment user's password")
+	rotatedeployment     = rotatecredentialscmd.Arg("deployment", "Deployment ID or name").Required().String()
+	rotateuser           = rotatecredentialscmd.Flag("user", "Database user").Default("admin").String()
+	rotatepasswordenv    = rotatecredentialscmd.Flag("password-env", "Environment variable holding the new password (generated if unset)").String()
+	rotatepasswordfile   = rotatecredentialscmd.Flag("password-file", "File holding the new password (generated if unset)").String()
+	rotatepasswordlength = rotatecredentialscmd.Flag("password-length", "Length of generated passwords").Default("32").Int()
+	rotatetimeout        = rotatecredentialscmd.Flag("timeout", "How long to wait for the recipe").Default("10m").Duration()
+	rotateoutput         = rotatecredentialscmd.Flag("output", "File to write the new connection strings to as a .env file").Short('o').String()
+	rotatek8ssecret      = rotatecredentialscmd.Flag("k8s-secret", "File to write a Kubernetes Secret manifest to").String()
+	rotatenamespace      = rotatecredentialscmd.Flag("namespace", "Kubernetes namespace for --k8s-secret").String()
+
+	alertscmd            = app.Command("alerts", "Alerts...")
+	alertssetcmd         = alertscmd.Command("set", "Replace deployment alert settings")
+	alertssetdeployment  = alertssetcmd.Arg("deployment", "Deployment ID or name").Required().String()
+	alertssetemails      = alertssetcmd.Flag("email", "Email address to alert (repeatable)").Strings()
+	alertssetsms         = alertssetcmd.Flag("sms", "Phone number to alert by SMS (repeatable)").Strings()
+	alertssetpagerduty   = alertssetcmd.Flag("pagerduty", "PagerDuty service key to alert (repeatable)").Strings()
+	alertssetslack       = alertssetcmd.Flag("slack", "Slack webhook URL to alert (repeatable)").Strings()
+	alertssetfrom        = alertssetcmd.Flag("from", "Copy alert channels from another deployment").String()
+	alertssetdisableflag = alertssetcmd.Flag("disable", "Disable alerting").Default("false").Bool()
+
+	logscmd         = app.Command("logs", "List or download deployment log files")
+	logsdeployment  = logscmd.Arg("deployment", "Deployment ID or name").Required().String()
+	logsdownload    = logscmd.Flag("download", "Log file ID to download (repeatable)").Strings()
+	logsallflag     = logscmd.Flag("all", "Download all log files").Default("false").Bool()
+	logsdir         = logscmd.Flag("dir", "Directory to download log files to").Default(".").String()
+	logsconcurrency = logscmd.Flag("concurrency", "Number of log files to download at once").Default("4").Int()
+	logsgunzipflag  = logscmd.Flag("gunzip", "Decompress gzipped log files as they download").Default("false").Bool()
+	logsfollowflag  = logscmd.Flag("follow", "Print new log lines as they appear").Short('f').Default("false").Bool()
+	logssince       = logscmd.Flag("since", "Also print log files from this long ago from their start, e.g. 1h (with --follow)").Duration()
+	logsmatch       = logscmd.Flag("match", "Only print followed lines matching this regular expression").String()
+	logsinterval    = logscmd.Flag("interval", "How often to poll for new log lines").Default("10s").Duration()
+
+	monitorcmd           = app.Command("monitor", "Monitor deployment health, units and recipes")
+	monitordeployments   = monitorcmd.Arg("deployments", "Deployment IDs or names").Strings()
+	monitorallflag       = monitorcmd.Flag("all", "Monitor all deployments").Default("false").Bool()
+	monitorinterval      = monitorcmd.Flag("interval", "How often to refresh").Default("30s").Duration()
+	monitorjsonflag      = monitorcmd.Flag("json", "Write line-delimited JSON events rather than a dashboard").Default("false").Bool()
+	monitoronceflag      = monitorcmd.Flag("once", "Poll once and exit").Default("false").Bool()
+	monitorstuckafter    = monitorcmd.Flag("stuck-after", "Flag recipes running for longer than this").Default("30m").Duration()
+	monitorunitthreshold = monitorcmd.Flag("unit-threshold", "Flag deployments using this fraction of their units").Default("0.9").Float64()
+
+	exportercmd      = app.Command("exporter", "Serve deployment and API metrics for Prometheus")
+	exporterlisten   = exportercmd.Flag("listen", "Address to serve metrics on").Default(":9340").String()
+	exporterinterval = exportercmd.Flag("interval", "How often to refresh deployment state").Default("60s").Duration()
+
+	auditcmd            = app.Command("audit", "Audit...")
+	auditshowcmd        = auditcmd.Command("show", "Show the audit log of mutating commands")
+	auditshowsince      = auditshowcmd.Flag("since", "Only show records from this long ago, e.g. 24h").Duration()
+	auditshowcommand    = auditshowcmd.Flag("command", "Only show records for this command").String()
+	auditshowdeployment = auditshowcmd.Flag("deployment", "Only show records for this deployment ID").String()
+	auditshowoutcome    = auditshowcmd.Flag("outcome", "Only show records with this outcome").Enum("success", "error", "dry-run")
+
+	applycmd             = app.Command("apply", "Create and change deployments to match a manifest")
+	applyfile            = applycmd.Flag("file", "YAML manifest of deployments").Short('f').Required().ExistingFile()
+	applypruneflag       = applycmd.Flag("prune", "Remove whitelist entries the manifest doesn't list").Default("false").Bool()
+	applyautoapproveflag = applycmd.Flag("auto-approve", "Apply without asking for confirmation").Default("false").Bool()
+	applytimeout         = applycmd.Flag("timeout", "How long to wait for each recipe").Default("30m").Duration()
+	applyparallelism     = applycmd.Flag("parallelism", "Number of deployments to change at once").Default("4").Int()
+
+	diffcmd      = app.Command("diff", "Report how deployments have drifted from a manifest (exits 2 on drift)")
+	difffile     = diffcmd.Flag("file", "YAML manifest of deployments").Short('f').Required().ExistingFile()
+	diffjsonflag = diffcmd.Flag("json", "Write the report as JSON").Default("false").Bool()
 
 	apitoken = os.Getenv("COMPOSEAPITOKEN")
 )
@@ -65,21 +207,55 @@ const (
 )
 
 func bailOnErrs(errs []error) {
+	if composeapi.IsDryRun(errs) {
+		os.Exit(0)
+	}
 	if errs != nil {
 		log.Fatal(errs)
 	}
 }
 
+// stdout is where commands write their output
+var stdout io.Writer = os.Stdout
+
 func printAsJSON(toprint interface{}) {
 	jsonstr, _ := json.MarshalIndent(toprint, "", " ")
-	fmt.Println(string(jsonstr))
+	fmt.Fprintln(stdout, string(jsonstr))
 }
 func main() {
-	if apitoken == "" {
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	if command == "audit show" {
+		showAudit()
+		return
+	}
+
+	// Replayed calls never reach the API, so need no token
+	replaydir := os.Getenv("COCLI_REPLAY")
+	if replaydir != "" {
+		replayer, err := recording.NewReplayer(replaydir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		composeapi.Transport = replayer
+	} else if apitoken == "" {
 		log.Fatal("COMPOSEAPITOKEN environment variable not set")
 	}
 
-	switch kingpin.MustParse(app.Parse(os.Args[1:])) {
+	if recorddir := os.Getenv("COCLI_RECORD"); recorddir != "" {
+		composeapi.Transport = &recording.Recorder{Dir: recorddir, Transport: composeapi.Transport}
+	}
+	setupTracing()
+
+	composeapi.DryRun, composeapi.DryRunOutput = *dryrunflag, stdout
+	startAudit(command)
+
+	runCommand(command)
+}
+
+// runCommand runs the command kingpin parsed, once the API is set up
+func runCommand(command string) {
+	switch command {
 	case "show account":
 		showAccount()
 	case "show deployments":
@@ -88,18 +264,52 @@ func main() {
 		showRecipes()
 	case "show deployment versions":
 		showVersions()
+	case "show deployment users":
+		showDeploymentUsers()
+	case "show deployment scalings":
+		showScalings()
 	case "show recipe":
 		showRecipe()
 	case "show clusters":
 		showClusters()
 	case "show user":
 		showUser()
+	case "show alerts":
+		showAlerts()
 	case "show datacenters":
 		showDatacenters()
 	case "show databases":
 		showDatabases()
 	case "create deployment":
 		createDeployment()
+	case "open":
+		openDeployment()
+	case "connect":
+		connectDeployment()
+	case "cert":
+		showCert()
+	case "env":
+		showEnv()
+	case "export connection":
+		exportConnection()
+	case "export manifest":
+		exportManifest()
+	case "sync k8s":
+		syncK8s()
+	case "rotate credentials":
+		rotateCredentials()
+	case "alerts set":
+		setAlerts()
+	case "logs":
+		showLogs()
+	case "monitor":
+		monitorDeployments()
+	case "exporter":
+		runExporter()
+	case "apply":
+		applyManifest()
+	case "diff":
+		diffManifest()
 	}
 }
 
@@ -107,16 +317,16 @@ func showAccount() {
 	if *rawmodeflag {
 		text, errs := composeapi.GetAccountJSON()
 		bailOnErrs(errs)
-		fmt.Println(text)
+		fmt.Fprintln(stdout, text)
 	} else {
 		account, errs := composeapi.GetAccount()
 		bailOnErrs(errs)
 
 		if *formatflag {
-			fmt.Printf("%15s: %s\n", "ID", account.ID)
-			fmt.Printf("%15s: %s\n", "Name", account.Name)
-			fmt.Printf("%15s: %s\n", "Slug", account.Slug)
-			fmt.Println()
+			fmt.Fprintf(stdout, "%15s: %s\n", "ID", account.ID)
+			fmt.Fprintf(stdout, "%15s: %s\n", "Name", account.Name)
+			fmt.Fprintf(stdout, "%15s: %s\n", "Slug", account.Slug)
+			fmt.Fprintln(stdout)
 		} else {
 			printAsJSON(account)
 		}
@@ -127,19 +337,19 @@ func showDeployments() {
 	if *rawmodeflag {
 		text, errs := composeapi.GetDeploymentsJSON()
 		bailOnErrs(errs)
-		fmt.Println(text)
+		fmt.Fprintln(stdout, text)
 	} else {
 		deployments, errs := composeapi.GetDeployments()
 		bailOnErrs(errs)
 
 		if *formatflag {
 			for _, v := range *deployments {
-				fmt.Printf("%15s: %s\n", "ID", v.ID)
-				fmt.Printf("%15s: %s\n", "Name", v.Name)
-				fmt.Printf("%15s: %s\n", "Type", v.Type)
-				fmt.Printf("%15s: %s\n", "Created At", v.CreatedAt)
-				fmt.Printf("%15s: %s\n", "Web UI Link", getLink(v.Links.ComposeWebUILink))
-				fmt.Println()
+				fmt.Fprintf(stdout, "%15s: %s\n", "ID", v.ID)
+				fmt.Fprintf(stdout, "%15s: %s\n", "Name", v.Name)
+				fmt.Fprintf(stdout, "%15s: %s\n", "Type", v.Type)
+				fmt.Fprintf(stdout, "%15s: %s\n", "Created At", v.CreatedAt)
+				fmt.Fprintf(stdout, "%15s: %s\n", "Web UI Link", getLink(v.Links.ComposeWebUILink))
+				fmt.Fprintln(stdout)
 			}
 		} else {
 			printAsJSON(deployments)
@@ -151,13 +361,13 @@ func showRecipe() {
 	if *rawmodeflag {
 		text, errs := composeapi.GetRecipeJSON(*showrecipeid)
 		bailOnErrs(errs)
-		fmt.Println(text)
+		fmt.Fprintln(stdout, text)
 	} else {
 		recipe, errs := composeapi.GetRecipe(*rawmodeflag, *showrecipeid)
 		bailOnErrs(errs)
 
 		if *formatflag {
-			printRecipe(*recipe)
+			printRecipe(stdout, *recipe)
 		} else {
 			printAsJSON(*recipe)
 		}
@@ -166,17 +376,17 @@ func showRecipe() {
 
 func showRecipes() {
 	if *rawmodeflag {
-		fmt.Println(*showrecipesdepid)
+		fmt.Fprintln(stdout, *showrecipesdepid)
 		text, errs := composeapi.GetRecipesForDeploymentJSON(*showrecipesdepid)
 		bailOnErrs(errs)
-		fmt.Println(text)
+		fmt.Fprintln(stdout, text)
 	} else {
 		recipes, errs := composeapi.GetRecipesForDeployment(*showrecipesdepid)
 		bailOnErrs(errs)
 		if *formatflag {
 			for _, v := range *recipes {
-				printRecipe(v)
-				fmt.Println()
+				printRecipe(stdout, v)
+				fmt.Fprintln(stdout)
 			}
 		} else {
 			printAsJSON(*recipes)
@@ -188,14 +398,14 @@ func showVersions() {
 	if *rawmodeflag {
 		text, errs := composeapi.GetVersionsForDeploymentJSON(*showversionsdepid)
 		bailOnErrs(errs)
-		fmt.Println(text)
+		fmt.Fprintln(stdout, text)
 	} else {
 		versions, errs := composeapi.GetVersionsForDeployment(*showversionsdepid)
 		bailOnErrs(errs)
 		if *formatflag {
 			for _, v := range *versions {
-				printVersionTransitions(v)
-				fmt.Println()
+				printVersionTransitions(stdout, v)
+				fmt.Fprintln(stdout)
 			}
 		} else {
 			printAsJSON(*versions)
@@ -203,19 +413,55 @@ func showVersions() {
 	}
 }
 
+func showDeploymentUsers() {
+	if *rawmodeflag {
+		text, errs := composeapi.GetUsersForDeploymentJSON(*showusersdepid)
+		bailOnErrs(errs)
+		fmt.Fprintln(stdout, text)
+	} else {
+		users, errs := composeapi.GetUsersForDeployment(*showusersdepid)
+		bailOnErrs(errs)
+		if *formatflag {
+			for _, v := range *users {
+				fmt.Fprintf(stdout, "%15s: %s\n", "Username", v.Username)
+			}
+			fmt.Fprintln(stdout)
+		} else {
+			printAsJSON(*users)
+		}
+	}
+}
+
+func showScalings() {
+	if *rawmodeflag {
+		text, errs := composeapi.GetScalingsForDeploymentJSON(*showscalingsdepid)
+		bailOnErrs(errs)
+		fmt.Fprintln(stdout, text)
+	} else {
+		scalings, errs := composeapi.GetScalingsForDeployment(*showscalingsdepid)
+		bailOnErrs(errs)
+		if *formatflag {
+			printScalings(stdout, *scalings)
+			fmt.Fprintln(stdout)
+		} else {
+			printAsJSON(*scalings)
+		}
+	}
+}
+
 func showClusters() {
 	if *rawmodeflag {
 		text, errs := composeapi.GetClustersJSON()
 		bailOnErrs(errs)
-		fmt.Println(text)
+		fmt.Fprintln(stdout, text)
 	} else {
 		clusters, errs := composeapi.GetClusters()
 		bailOnErrs(errs)
 
 		if *formatflag {
 			for _, v := range *clusters {
-				printCluster(v)
-				fmt.Println()
+				printCluster(stdout, v)
+				fmt.Fprintln(stdout)
 			}
 		} else {
 			printAsJSON(clusters)
@@ -227,13 +473,13 @@ func showUser() {
 	if *rawmodeflag {
 		text, errs := composeapi.GetUserJSON()
 		bailOnErrs(errs)
-		fmt.Println(text)
+		fmt.Fprintln(stdout, text)
 	} else {
 		user, errs := composeapi.GetUser()
 		bailOnErrs(errs)
 		if *formatflag {
-			fmt.Printf("%15s: %s\n", "ID", user.ID)
-			fmt.Println()
+			fmt.Fprintf(stdout, "%15s: %s\n", "ID", user.ID)
+			fmt.Fprintln(stdout)
 		} else {
 			printAsJSON(user)
 		}
@@ -244,15 +490,15 @@ func showDatacenters() {
 	if *rawmodeflag {
 		text, errs := composeapi.GetDatacentersJSON()
 		bailOnErrs(errs)
-		fmt.Println(text)
+		fmt.Fprintln(stdout, text)
 	} else {
 		datacenters, errs := composeapi.GetDatacenters()
 		bailOnErrs(errs)
 
 		if *formatflag {
 			for _, v := range *datacenters {
-				printDatacenter(v)
-				fmt.Println()
+				printDatacenter(stdout, v)
+				fmt.Fprintln(stdout)
 			}
 		} else {
 			printAsJSON(datacenters)
@@ -264,15 +510,15 @@ func showDatabases() {
 	if *rawmodeflag {
 		text, errs := composeapi.GetDatabasesJSON()
 		bailOnErrs(errs)
-		fmt.Println(text)
+		fmt.Fprintln(stdout, text)
 	} else {
 		databases, errs := composeapi.GetDatabases()
 		bailOnErrs(errs)
 
 		if *formatflag {
 			for _, v := range *databases {
-				printDatabase(v)
-				fmt.Println()
+				printDatabase(stdout, v)
+				fmt.Fprintln(stdout)
 			}
 		} else {
 			printAsJSON(databases)
@@ -288,107 +534,262 @@ func createDeployment() {
 	account, errs := composeapi.GetAccount()
 	bailOnErrs(errs)
 
-	if *createdeploymentdatacenter == "" && *createdeploymentcluster == "" {
-		log.Fatal("Must supply either a --cluster id or --datacenter region")
+	params := composeapi.CreateDeploymentParams{}
+	if *createdeploymentfile != "" {
+		if err := readParamsFile(*createdeploymentfile, &params); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	params := composeapi.CreateDeploymentParams{
-		Name:         *createdeploymentname,
-		AccountID:    account.ID,
-		DatabaseType: *createdeploymenttype,
-		Datacenter:   *createdeploymentdatacenter,
-		ClusterID:    *createdeploymentcluster,
+	// Anything given on the command line overrides the file. A location given
+	// on the command line replaces the file's, whichever kind it is.
+	params.AccountID = account.ID
+	if *createdeploymentdatacenter != "" || *createdeploymentcluster != "" {
+		params.Datacenter = *createdeploymentdatacenter
+		params.ClusterID = *createdeploymentcluster
+	}
+	overrideString(&params.Name, *createdeploymentname)
+	overrideString(&params.DatabaseType, *createdeploymenttype)
+	overrideString(&params.Version, *createdeploymentversion)
+	overrideString(&params.Notes, *createdeploymentnotes)
+	if *createdeploymentunits != 0 {
+		params.Units = *createdeploymentunits
+	}
+	overrideBool(&params.SSL, "ssl", *createdeploymentssl)
+	overrideBool(&params.WiredTiger, "wiredtiger", *createdeploymentwiredtiger)
+	overrideBool(&params.CacheMode, "cache-mode", *createdeploymentcachemode)
+	if len(*createdeploymenttags) > 0 {
+		params.Tags = *createdeploymenttags
+	}
+
+	errs = checkCreateParams(params)
+	if !*createdeploymentnovalidate {
+		errs = append(errs, validateCreateParams(params)...)
+	}
+	if errs != nil {
+		for _, v := range errs {
+			log.Println(v)
+		}
+		os.Exit(1)
 	}
 
 	deployment, errs := composeapi.CreateDeployment(params)
 	bailOnErrs(errs)
 
 	if deployment.Errors.Error != "" {
-		fmt.Printf("Error: %s\n", deployment.Errors.Error)
+		fmt.Fprintf(stdout, "Error: %s\n", deployment.Errors.Error)
 	} else {
 		if *formatflag {
-			printDeployment(*deployment)
+			printDeployment(stdout, *deployment)
 		} else {
 			printAsJSON(*deployment)
 		}
 	}
 }
+
+// readParamsFile reads JSON or YAML parameters into params
+func readParamsFile(filename string, params interface{}) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	// YAML is a superset of JSON, so this reads either
+	if err := yaml.Unmarshal(data, params); err != nil {
+		return fmt.Errorf("parsing %s: %s", filename, err)
+	}
+
+	return nil
+}
+
+func overrideString(target *string, value string) {
+	if value != "" {
+		*target = value
+	}
+}
+
+// userflags records the flags given on the command line, as bool flags'
+// values can't say whether they were
+var userflags = map[string]bool{}
+
+// recordFlag is the action of flags whose presence overrideBool checks
+func recordFlag(name string) kingpin.Action {
+	return func(*kingpin.ParseContext) error {
+		userflags[name] = true
+		return nil
+	}
+}
+
+// overrideBool sets target to value if the flag name was given, as --name or
+// --no-name
+func overrideBool(target *bool, name string, value bool) {
+	if userflags[name] {
+		*target = value
+	}
+}
+
+func openDeployment() {
+	deployment := getDeployment(*opendeployment)
+	link := getLink(deployment.Links.ComposeWebUILink)
+
+	if link == "" {
+		log.Fatalf("No web UI link for deployment %s", deployment.Name)
+	}
+
+	if *openprintflag {
+		fmt.Fprintln(stdout, link)
+		return
+	}
+
+	if err := openBrowser(link); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// getDeployment finds a deployment by ID or name and fetches it in full
+func getDeployment(idorname string) *composeapi.Deployment {
+	deployments, errs := composeapi.GetDeployments()
+	bailOnErrs(errs)
+
+	for _, v := range *deployments {
+		if v.ID == idorname || v.Name == idorname {
+			deployment, errs := composeapi.GetDeployment(v.ID)
+			bailOnErrs(errs)
+			return deployment
+		}
+	}
+
+	log.Fatalf("Deployment not found: %s", idorname)
+	return nil
+}
+
+// selectDeployments finds deployments by ID or name, or all of them
+func selectDeployments(idsornames []string, all bool) []composeapi.Deployment {
+	deployments, errs := composeapi.GetDeployments()
+	bailOnErrs(errs)
+
+	if all {
+		return *deployments
+	}
+	if len(idsornames) == 0 {
+		log.Fatal("Must supply deployments or --all")
+	}
+
+	var selected []composeapi.Deployment
+	for _, idorname := range idsornames {
+		found := false
+		for _, v := range *deployments {
+			if v.ID == idorname || v.Name == idorname {
+				selected = append(selected, v)
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Fatalf("Deployment not found: %s", idorname)
+		}
+	}
+
+	return selected
+}
+
+func openBrowser(link string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", link).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", link).Start()
+	default:
+		return exec.Command("xdg-open", link).Start()
+	}
+}
+
 func getLink(link composeapi.Link) string {
-	return strings.Replace(link.HREF, "{?embed}", "", -1) // TODO: This should mangle the HREF properly
-}
-
-func printRecipe(recipe composeapi.Recipe) {
-	fmt.Printf("%15s: %s\n", "ID", recipe.ID)
-	fmt.Printf("%15s: %s\n", "Template", recipe.Template)
-	fmt.Printf("%15s: %s\n", "Status", recipe.Status)
-	fmt.Printf("%15s: %s\n", "Status Detail", recipe.StatusDetail)
-	fmt.Printf("%15s: %s\n", "Account ID", recipe.AccountID)
-	fmt.Printf("%15s: %s\n", "Deployment ID", recipe.DeploymentID)
-	fmt.Printf("%15s: %s\n", "Name", recipe.Name)
-	fmt.Printf("%15s: %d\n", "Child Recipes", len(recipe.Embedded.Recipes))
-
-}
-
-func printVersionTransitions(version composeapi.VersionTransition) {
-	fmt.Printf("%15s: %s\n", "Application", version.Application)
-	fmt.Printf("%15s: %s\n", "Method", version.Method)
-	fmt.Printf("%15s: %s\n", "From Version", version.FromVersion)
-	fmt.Printf("%15s: %s\n", "To Version", version.ToVersion)
-}
-func printCluster(cluster composeapi.Cluster) {
-	fmt.Printf("%15s: %s\n", "ID", cluster.ID)
-	fmt.Printf("%15s: %s\n", "Account ID", cluster.AccountID)
-	fmt.Printf("%15s: %s\n", "Account Slug", cluster.AccountSlug)
-	fmt.Printf("%15s: %s\n", "Name", cluster.Name)
-	fmt.Printf("%15s: %s\n", "Type", cluster.Type)
-	fmt.Printf("%15s: %t\n", "Multitenant", cluster.Multitenant)
-	fmt.Printf("%15s: %s\n", "Provider", cluster.Provider)
-	fmt.Printf("%15s: %s\n", "Region", cluster.Region)
-	fmt.Printf("%15s: %s\n", "Created Ad", cluster.CreatedAt)
-	fmt.Printf("%15s: %s\n", "Subdomain", cluster.Subdomain)
-}
-
-func printDatacenter(datacenter composeapi.Datacenter) {
-	fmt.Printf("%15s: %s\n", "Region", datacenter.Region)
-	fmt.Printf("%15s: %s\n", "Provider", datacenter.Provider)
-	fmt.Printf("%15s: %s\n", "Slug", datacenter.Slug)
-}
-
-func printDeployment(deployment composeapi.Deployment) {
-	fmt.Printf("%15s: %s\n", "ID", deployment.ID)
-	fmt.Printf("%15s: %s\n", "Name", deployment.Name)
-	fmt.Printf("%15s: %s\n", "Type", deployment.Type)
-	fmt.Printf("%15s: %s\n", "Created At", deployment.CreatedAt)
+	return link.Expand(nil)
+}
+
+func printRecipe(w io.Writer, recipe composeapi.Recipe) {
+	fmt.Fprintf(w, "%15s: %s\n", "ID", recipe.ID)
+	fmt.Fprintf(w, "%15s: %s\n", "Template", recipe.Template)
+	fmt.Fprintf(w, "%15s: %s\n", "Status", recipe.Status)
+	fmt.Fprintf(w, "%15s: %s\n", "Status Detail", recipe.StatusDetail)
+	fmt.Fprintf(w, "%15s: %s\n", "Account ID", recipe.AccountID)
+	fmt.Fprintf(w, "%15s: %s\n", "Deployment ID", recipe.DeploymentID)
+	fmt.Fprintf(w, "%15s: %s\n", "Name", recipe.Name)
+	fmt.Fprintf(w, "%15s: %d\n", "Child Recipes", len(recipe.Embedded.Recipes))
+
+}
+
+func printVersionTransitions(w io.Writer, version composeapi.VersionTransition) {
+	fmt.Fprintf(w, "%15s: %s\n", "Application", version.Application)
+	fmt.Fprintf(w, "%15s: %s\n", "Method", version.Method)
+	fmt.Fprintf(w, "%15s: %s\n", "From Version", version.FromVersion)
+	fmt.Fprintf(w, "%15s: %s\n", "To Version", version.ToVersion)
+}
+func printScalings(w io.Writer, scalings composeapi.Scalings) {
+	fmt.Fprintf(w, "%15s: %d\n", "Allocated Units", scalings.AllocatedUnits)
+	fmt.Fprintf(w, "%15s: %d\n", "Used Units", scalings.UsedUnits)
+	fmt.Fprintf(w, "%15s: %d\n", "Starting Units", scalings.StartingUnits)
+	fmt.Fprintf(w, "%15s: %d\n", "Minimum Units", scalings.MinimumUnits)
+	fmt.Fprintf(w, "%15s: %d\n", "Unit Size (MB)", scalings.UnitSizeInMB)
+	fmt.Fprintf(w, "%15s: %s\n", "Unit Type", scalings.UnitType)
+}
+
+func printCluster(w io.Writer, cluster composeapi.Cluster) {
+	fmt.Fprintf(w, "%15s: %s\n", "ID", cluster.ID)
+	fmt.Fprintf(w, "%15s: %s\n", "Account ID", cluster.AccountID)
+	fmt.Fprintf(w, "%15s: %s\n", "Account Slug", cluster.AccountSlug)
+	fmt.Fprintf(w, "%15s: %s\n", "Name", cluster.Name)
+	fmt.Fprintf(w, "%15s: %s\n", "Type", cluster.Type)
+	fmt.Fprintf(w, "%15s: %t\n", "Multitenant", cluster.Multitenant)
+	fmt.Fprintf(w, "%15s: %s\n", "Provider", cluster.Provider)
+	fmt.Fprintf(w, "%15s: %s\n", "Region", cluster.Region)
+	fmt.Fprintf(w, "%15s: %s\n", "Created Ad", cluster.CreatedAt)
+	fmt.Fprintf(w, "%15s: %s\n", "Subdomain", cluster.Subdomain)
+}
+
+func printDatacenter(w io.Writer, datacenter composeapi.Datacenter) {
+	fmt.Fprintf(w, "%15s: %s\n", "Region", datacenter.Region)
+	fmt.Fprintf(w, "%15s: %s\n", "Provider", datacenter.Provider)
+	fmt.Fprintf(w, "%15s: %s\n", "Slug", datacenter.Slug)
+}
+
+func printDeployment(w io.Writer, deployment composeapi.Deployment) {
+	fmt.Fprintf(w, "%15s: %s\n", "ID", deployment.ID)
+	fmt.Fprintf(w, "%15s: %s\n", "Name", deployment.Name)
+	fmt.Fprintf(w, "%15s: %s\n", "Type", deployment.Type)
+	fmt.Fprintf(w, "%15s: %s\n", "Created At", deployment.CreatedAt)
 	if deployment.ProvisionRecipeID != "" {
-		fmt.Printf("%15s: %s\n", "Prov Recipe ID", deployment.ProvisionRecipeID)
+		fmt.Fprintf(w, "%15s: %s\n", "Prov Recipe ID", deployment.ProvisionRecipeID)
 	}
 	if deployment.CACertificateBase64 != "" {
-		if *fullcaflag {
-			fmt.Printf("%15s: %s\n", "CA Certificate", deployment.CACertificateBase64)
+		// Certificates too short to abbreviate are shown whole
+		if *fullcaflag || len(deployment.CACertificateBase64) <= 32 {
+			fmt.Fprintf(w, "%15s: %s\n", "CA Certificate", deployment.CACertificateBase64)
 		} else {
-			fmt.Printf("%15s: %s...\n", "CA Certificate", deployment.CACertificateBase64[0:32])
+			fmt.Fprintf(w, "%15s: %s...\n", "CA Certificate", deployment.CACertificateBase64[0:32])
 		}
 	}
-	fmt.Printf("%15s: %s\n", "Web UI Link", getLink(deployment.Links.ComposeWebUILink))
-	fmt.Printf("%15s: %s\n", "Health", deployment.Connection.Health)
-	fmt.Printf("%15s: %s\n", "SSH", deployment.Connection.SSH)
-	fmt.Printf("%15s: %s\n", "Admin", deployment.Connection.Admin)
-	fmt.Printf("%15s: %s\n", "SSHAdmin", deployment.Connection.SSHAdmin)
-	fmt.Printf("%15s: %s\n", "CLI Connect", deployment.Connection.CLI)
-	fmt.Printf("%15s: %s\n", "Direct Connect", deployment.Connection.Direct)
+	fmt.Fprintf(w, "%15s: %s\n", "Web UI Link", getLink(deployment.Links.ComposeWebUILink))
+	fmt.Fprintf(w, "%15s: %s\n", "Health", deployment.Connection.Health)
+	fmt.Fprintf(w, "%15s: %s\n", "SSH", deployment.Connection.SSH)
+	fmt.Fprintf(w, "%15s: %s\n", "Admin", deployment.Connection.Admin)
+	fmt.Fprintf(w, "%15s: %s\n", "SSHAdmin", deployment.Connection.SSHAdmin)
+	fmt.Fprintf(w, "%15s: %s\n", "CLI Connect", deployment.Connection.CLI)
+	fmt.Fprintf(w, "%15s: %s\n", "Direct Connect", deployment.Connection.Direct)
 
 }
 
-func printDatabase(database composeapi.Database) {
-	fmt.Printf("%15s: %s\n", "Type", database.DatabaseType)
-	fmt.Printf("%15s: %s\n", "Status", database.Status)
+func printDatabase(w io.Writer, database composeapi.Database) {
+	fmt.Fprintf(w, "%15s: %s\n", "Type", database.DatabaseType)
+	fmt.Fprintf(w, "%15s: %s\n", "Status", database.Status)
 
 	for _, v := range database.Embedded.Versions {
 		if v.Status != "deprecated" {
 			if v.Preferred {
-				fmt.Printf("%15s: %s (%s) Preferred\n", "Version", v.Version, v.Status)
+				fmt.Fprintf(w, "%15s: %s (%s) Preferred\n", "Version", v.Version, v.Status)
 			} else {
-				fmt.Printf("%15s: %s (%s)\n", "Version", v.Version, v.Status)
+				fmt.Fprintf(w, "%15s: %s (%s)\n", "Version", v.Version, v.Status)
 			}
 		}
 	}
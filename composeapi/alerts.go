@@ -0,0 +1,45 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeapi
+
+// Alert channel types
+const (
+	AlertChannelEmail     = "email"
+	AlertChannelSMS       = "sms"
+	AlertChannelPagerDuty = "pagerduty"
+	AlertChannelSlack     = "slack"
+)
+
+//AlertChannel somewhere alerts for a deployment are sent
+type AlertChannel struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+//Alerts structure
+type Alerts struct {
+	Errors struct {
+		Error string `json:"error,omitempty"`
+	} `json:"errors,omitempty"`
+	DeploymentID string         `json:"deployment_id"`
+	Enabled      bool           `json:"enabled"`
+	Channels     []AlertChannel `json:"channels"`
+}
+
+//AlertsParams Parameters to be completed before updating alerts
+type AlertsParams struct {
+	Enabled  bool           `json:"enabled"`
+	Channels []AlertChannel `json:"channels"`
+}
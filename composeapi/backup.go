@@ -0,0 +1,38 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeapi
+
+import (
+	"time"
+)
+
+//Backup structure
+type Backup struct {
+	ID             string    `json:"id"`
+	DeploymentID   string    `json:"deployment_id"`
+	Name           string    `json:"name"`
+	Type           string    `json:"type"`
+	Status         string    `json:"status"`
+	CreatedAt      time.Time `json:"created_at"`
+	IsDownloadable bool      `json:"is_downloadable"`
+	DownloadLink   string    `json:"download_link"`
+}
+
+//BackupsResponse structure (an array of Backup)
+type BackupsResponse struct {
+	Embedded struct {
+		Backups []Backup `json:"backups"`
+	} `json:"_embedded"`
+}
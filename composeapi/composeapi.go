@@ -15,22 +15,48 @@
 package composeapi
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
-
-	"github.com/parnurzeal/gorequest"
+	"strings"
+	"time"
 )
 
 var (
-	apitoken = os.Getenv("COMPOSEAPITOKEN")
+	//APIToken authorizes every call. It defaults to $COMPOSEAPITOKEN.
+	APIToken = os.Getenv("COMPOSEAPITOKEN")
+
+	//APIBase is the URL endpoints are relative to. $COMPOSEAPIURL overrides
+	//the default, to point at a fake API for example.
+	APIBase = apiBase()
+
+	//Transport carries every call when set, in place of the default HTTP
+	//transport. It lets calls be recorded or replayed, or sent through a
+	//proxy or with client certificates. Middleware added with Use wraps it.
+	Transport http.RoundTripper
 )
 
 const (
-	apibase = "https://api.compose.io/2016-07/"
+	defaultapibase = "https://api.compose.io/2016-07/"
 )
 
+func apiBase() string {
+	base := os.Getenv("COMPOSEAPIURL")
+	if base == "" {
+		return defaultapibase
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base
+}
+
 // Link structure for JSON+HAL links
 type Link struct {
 	HREF      string `json:"href"`
@@ -52,12 +78,7 @@ func printJSON(jsontext string) {
 
 //GetJSON Gets JSON string of content at an endpoint
 func getJSON(endpoint string) (string, []error) {
-	_, body, errs := gorequest.New().Get(apibase+endpoint).
-		Set("Authorization", "Bearer "+apitoken).
-		Set("Content-type", "json").
-		End()
-
-	return body, errs
+	return doJSON("GET", endpoint, nil)
 }
 
 //GetAccountJSON gets JSON string from endpoint
@@ -96,6 +117,25 @@ func GetDeployments() (*[]Deployment, []error) {
 	return &deployments, nil
 }
 
+//GetDeploymentJSON returns raw deployment for deploymentid
+func GetDeploymentJSON(deploymentid string) (string, []error) {
+	return getJSON("deployments/" + deploymentid)
+}
+
+//GetDeployment returns deployment structure for deploymentid
+func GetDeployment(deploymentid string) (*Deployment, []error) {
+	body, errs := GetDeploymentJSON(deploymentid)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	deployment := Deployment{}
+	json.Unmarshal([]byte(body), &deployment)
+
+	return &deployment, nil
+}
+
 //GetRecipeJSON Gets raw JSON for recipeid
 func GetRecipeJSON(recipeid string) (string, []error) { return getJSON("recipes/" + recipeid) }
 
@@ -153,6 +193,179 @@ func GetVersionsForDeployment(deploymentid string) (*[]VersionTransition, []erro
 	return &versionTransitions, nil
 }
 
+//GetScalingsForDeploymentJSON returns raw JSON for getScalingsForDeployment
+func GetScalingsForDeploymentJSON(deploymentid string) (string, []error) {
+	return getJSON("deployments/" + deploymentid + "/scalings")
+}
+
+//GetScalingsForDeployment gets units allocated to and used by a deployment
+func GetScalingsForDeployment(deploymentid string) (*Scalings, []error) {
+	body, errs := GetScalingsForDeploymentJSON(deploymentid)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	scalings := Scalings{}
+	json.Unmarshal([]byte(body), &scalings)
+
+	return &scalings, nil
+}
+
+//SetScalingsForDeploymentJSON performs the call
+func SetScalingsForDeploymentJSON(deploymentid string, params ScalingsParams) (string, []error) {
+	return sendJSON("POST", "deployments/"+deploymentid+"/scalings", params)
+}
+
+//SetScalingsForDeployment changes the units allocated to a deployment,
+//returning the recipe which carries out the change
+func SetScalingsForDeployment(deploymentid string, params ScalingsParams) (*Recipe, []error) {
+	return recipeResponse(SetScalingsForDeploymentJSON(deploymentid, params))
+}
+
+//UpdateVersionForDeploymentJSON performs the call
+func UpdateVersionForDeploymentJSON(deploymentid string, params UpdateVersionParams) (string, []error) {
+	return sendJSON("PATCH", "deployments/"+deploymentid+"/versions", params)
+}
+
+//UpdateVersionForDeployment upgrades a deployment to another version,
+//returning the recipe which carries out the change
+func UpdateVersionForDeployment(deploymentid string, params UpdateVersionParams) (*Recipe, []error) {
+	return recipeResponse(UpdateVersionForDeploymentJSON(deploymentid, params))
+}
+
+//DeprovisionDeploymentJSON performs the call
+func DeprovisionDeploymentJSON(deploymentid string) (string, []error) {
+	return sendJSON("DELETE", "deployments/"+deploymentid, nil)
+}
+
+//DeprovisionDeployment deletes a deployment, returning the recipe which
+//carries out the deletion
+func DeprovisionDeployment(deploymentid string) (*Recipe, []error) {
+	return recipeResponse(DeprovisionDeploymentJSON(deploymentid))
+}
+
+//GetWhitelistForDeploymentJSON returns raw JSON for getWhitelistForDeployment
+func GetWhitelistForDeploymentJSON(deploymentid string) (string, []error) {
+	return getJSON("deployments/" + deploymentid + "/whitelist")
+}
+
+//GetWhitelistForDeployment gets the IP whitelist of a deployment
+func GetWhitelistForDeployment(deploymentid string) (*[]WhitelistEntry, []error) {
+	body, errs := GetWhitelistForDeploymentJSON(deploymentid)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	whitelistResponse := WhitelistResponse{}
+	json.Unmarshal([]byte(body), &whitelistResponse)
+	whitelist := whitelistResponse.Embedded.Whitelist
+
+	return &whitelist, nil
+}
+
+//AddWhitelistForDeploymentJSON performs the call
+func AddWhitelistForDeploymentJSON(deploymentid string, params WhitelistParams) (string, []error) {
+	return sendJSON("POST", "deployments/"+deploymentid+"/whitelist", params)
+}
+
+//AddWhitelistForDeployment adds an IP or range to a deployment's whitelist,
+//returning the recipe which carries out the change
+func AddWhitelistForDeployment(deploymentid string, params WhitelistParams) (*Recipe, []error) {
+	return recipeResponse(AddWhitelistForDeploymentJSON(deploymentid, params))
+}
+
+//DeleteWhitelistForDeploymentJSON performs the call
+func DeleteWhitelistForDeploymentJSON(deploymentid string, whitelistid string) (string, []error) {
+	return sendJSON("DELETE", "deployments/"+deploymentid+"/whitelist/"+whitelistid, nil)
+}
+
+//DeleteWhitelistForDeployment removes an entry from a deployment's
+//whitelist, returning the recipe which carries out the change
+func DeleteWhitelistForDeployment(deploymentid string, whitelistid string) (*Recipe, []error) {
+	return recipeResponse(DeleteWhitelistForDeploymentJSON(deploymentid, whitelistid))
+}
+
+//GetTeamsJSON returns raw JSON for getTeams
+func GetTeamsJSON() (string, []error) {
+	return getJSON("teams")
+}
+
+//GetTeams gets the teams of the account
+func GetTeams() (*[]Team, []error) {
+	body, errs := GetTeamsJSON()
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	teamsResponse := TeamsResponse{}
+	json.Unmarshal([]byte(body), &teamsResponse)
+	teams := teamsResponse.Embedded.Teams
+
+	return &teams, nil
+}
+
+//GetTeamRolesForDeploymentJSON returns raw JSON for getTeamRolesForDeployment
+func GetTeamRolesForDeploymentJSON(deploymentid string) (string, []error) {
+	return getJSON("deployments/" + deploymentid + "/team_roles")
+}
+
+//GetTeamRolesForDeployment gets the roles teams have on a deployment
+func GetTeamRolesForDeployment(deploymentid string) (*[]TeamRole, []error) {
+	body, errs := GetTeamRolesForDeploymentJSON(deploymentid)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	teamRolesResponse := TeamRolesResponse{}
+	json.Unmarshal([]byte(body), &teamRolesResponse)
+	teamRoles := teamRolesResponse.Embedded.TeamRoles
+
+	return &teamRoles, nil
+}
+
+//AddTeamRoleForDeploymentJSON performs the call
+func AddTeamRoleForDeploymentJSON(deploymentid string, params TeamRoleParams) (string, []error) {
+	return sendJSON("POST", "deployments/"+deploymentid+"/team_roles", params)
+}
+
+//AddTeamRoleForDeployment gives a team a role on a deployment
+func AddTeamRoleForDeployment(deploymentid string, params TeamRoleParams) (*TeamRole, []error) {
+	body, errs := AddTeamRoleForDeploymentJSON(deploymentid, params)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	teamRole := TeamRole{}
+	json.Unmarshal([]byte(body), &teamRole)
+
+	return &teamRole, nil
+}
+
+//GetBackupsForDeploymentJSON returns raw JSON for getBackupsForDeployment
+func GetBackupsForDeploymentJSON(deploymentid string) (string, []error) {
+	return getJSON("deployments/" + deploymentid + "/backups")
+}
+
+//GetBackupsForDeployment gets the backups of a deployment
+func GetBackupsForDeployment(deploymentid string) (*[]Backup, []error) {
+	body, errs := GetBackupsForDeploymentJSON(deploymentid)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	backupsResponse := BackupsResponse{}
+	json.Unmarshal([]byte(body), &backupsResponse)
+	backups := backupsResponse.Embedded.Backups
+
+	return &backups, nil
+}
+
 //GetClustersJSON gets clusters available
 func GetClustersJSON() (string, []error) {
 	return getJSON("clusters")
@@ -231,14 +444,81 @@ func GetUser() (*User, []error) {
 	return &user, nil
 }
 
+//sendJSON sends params as JSON to an endpoint with method. Observers are
+//told about calls DryRun skips too, so dry runs can be audited.
+func sendJSON(method string, endpoint string, params interface{}) (string, []error) {
+	if DryRun {
+		start := time.Now()
+		errs := printDryRun(method, endpoint, params)
+		notifyCall(method, endpoint, params, start, 0, "", errs)
+		return "", errs
+	}
+
+	return doJSON(method, endpoint, params)
+}
+
+//doJSON calls an endpoint, sending params as JSON if there are any, and
+//returns the response body. Error statuses aren't errors; their body says
+//what went wrong.
+func doJSON(method string, endpoint string, params interface{}) (string, []error) {
+	start := time.Now()
+	body, statuscode, err := roundTrip(method, endpoint, params)
+	var errs []error
+	if err != nil {
+		errs = []error{err}
+	}
+	notifyCall(method, endpoint, params, start, statuscode, body, errs)
+
+	return body, errs
+}
+
+func roundTrip(method string, endpoint string, params interface{}) (string, int, error) {
+	var reqbody io.Reader
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return "", 0, err
+		}
+		reqbody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, APIBase+endpoint, reqbody)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if params != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	resp, err := client().Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", resp.StatusCode, err
+	}
+	return string(body), resp.StatusCode, nil
+}
+
+//recipeResponse unmarshals the recipe most mutating calls respond with
+func recipeResponse(body string, errs []error) (*Recipe, []error) {
+	if errs != nil {
+		return nil, errs
+	}
+
+	recipe := Recipe{}
+	json.Unmarshal([]byte(body), &recipe)
+
+	return &recipe, nil
+}
+
 //CreateDeploymentJSON performs the call
 func CreateDeploymentJSON(params CreateDeploymentParams) (string, []error) {
-	_, body, errs := gorequest.New().Post(apibase+"deployments").
-		Set("Authorization", "Bearer "+apitoken).
-		Set("Content-type", "application/json; charset=utf-8").
-		Send(params).
-		End()
-	return body, errs
+	return sendJSON("POST", "deployments", params)
 }
 
 //CreateDeployment creates a deployment
@@ -257,3 +537,194 @@ func CreateDeployment(params CreateDeploymentParams) (*Deployment, []error) {
 
 	return &deployed, nil
 }
+
+//GetUsersForDeploymentJSON returns raw JSON for getUsersForDeployment
+func GetUsersForDeploymentJSON(deploymentid string) (string, []error) {
+	return getJSON("deployments/" + deploymentid + "/users")
+}
+
+//GetUsersForDeployment gets the database users of a deployment
+func GetUsersForDeployment(deploymentid string) (*[]DeploymentUser, []error) {
+	body, errs := GetUsersForDeploymentJSON(deploymentid)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	usersResponse := DeploymentUsersResponse{}
+	json.Unmarshal([]byte(body), &usersResponse)
+	users := usersResponse.Embedded.Users
+
+	return &users, nil
+}
+
+//ChangePasswordForDeploymentUserJSON performs the call
+func ChangePasswordForDeploymentUserJSON(deploymentid string, username string, params ChangePasswordParams) (string, []error) {
+	return sendJSON("PATCH", "deployments/"+deploymentid+"/users/"+username, params)
+}
+
+//ChangePasswordForDeploymentUser changes a database user's password,
+//returning the recipe which carries out the change
+func ChangePasswordForDeploymentUser(deploymentid string, username string, params ChangePasswordParams) (*Recipe, []error) {
+	return recipeResponse(ChangePasswordForDeploymentUserJSON(deploymentid, username, params))
+}
+
+//GetAlertsForDeploymentJSON returns raw JSON for getAlertsForDeployment
+func GetAlertsForDeploymentJSON(deploymentid string) (string, []error) {
+	return getJSON("deployments/" + deploymentid + "/alerts")
+}
+
+//GetAlertsForDeployment gets the alert settings of a deployment
+func GetAlertsForDeployment(deploymentid string) (*Alerts, []error) {
+	body, errs := GetAlertsForDeploymentJSON(deploymentid)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	alerts := Alerts{}
+	json.Unmarshal([]byte(body), &alerts)
+
+	return &alerts, nil
+}
+
+//UpdateAlertsForDeploymentJSON performs the call
+func UpdateAlertsForDeploymentJSON(deploymentid string, params AlertsParams) (string, []error) {
+	return sendJSON("PUT", "deployments/"+deploymentid+"/alerts", params)
+}
+
+//UpdateAlertsForDeployment replaces the alert settings of a deployment
+func UpdateAlertsForDeployment(deploymentid string, params AlertsParams) (*Alerts, []error) {
+	body, errs := UpdateAlertsForDeploymentJSON(deploymentid, params)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	alerts := Alerts{}
+	json.Unmarshal([]byte(body), &alerts)
+
+	return &alerts, nil
+}
+
+//GetLogfilesForDeploymentJSON returns raw JSON for getLogfilesForDeployment
+func GetLogfilesForDeploymentJSON(deploymentid string) (string, []error) {
+	return getJSON("deployments/" + deploymentid + "/logfiles")
+}
+
+//GetLogfilesForDeployment gets the log files available for a deployment
+func GetLogfilesForDeployment(deploymentid string) (*[]Logfile, []error) {
+	body, errs := GetLogfilesForDeploymentJSON(deploymentid)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	logfilesResponse := LogfilesResponse{}
+	json.Unmarshal([]byte(body), &logfilesResponse)
+	logfiles := logfilesResponse.Embedded.Logfiles
+
+	return &logfiles, nil
+}
+
+//GetLogfileJSON returns raw JSON for getLogfile
+func GetLogfileJSON(deploymentid string, logfileid string) (string, []error) {
+	return getJSON("deployments/" + deploymentid + "/logfiles/" + logfileid)
+}
+
+//GetLogfile gets a log file, including its download link
+func GetLogfile(deploymentid string, logfileid string) (*Logfile, []error) {
+	body, errs := GetLogfileJSON(deploymentid, logfileid)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	logfile := Logfile{}
+	json.Unmarshal([]byte(body), &logfile)
+
+	return &logfile, nil
+}
+
+//ErrLogfileShrunk is returned by DownloadLogfileFrom when a log file has
+//become shorter than the offset asked for
+var ErrLogfileShrunk = errors.New("log file is shorter than the offset asked for")
+
+//DownloadLogfile copies the content of a log file to w
+func DownloadLogfile(logfile Logfile, w io.Writer) []error {
+	return DownloadLogfileFrom(logfile, 0, w)
+}
+
+//DownloadLogfileFrom copies the content of a log file after its first
+//offset bytes to w, asking for only that range. Where the server sends the
+//whole file anyway, the first offset bytes are skipped.
+func DownloadLogfileFrom(logfile Logfile, offset int64, w io.Writer) []error {
+	if logfile.DownloadLink == "" {
+		return []error{fmt.Errorf("no download link for logfile %s", logfile.ID)}
+	}
+
+	req, err := http.NewRequest("GET", logfile.DownloadLink, nil)
+	if err != nil {
+		return []error{err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client().Do(req)
+	if err != nil {
+		return []error{err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// Nothing has been added, unless the file has been cut short
+		var size int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes */%d", &size); err == nil && size < offset {
+			return []error{ErrLogfileShrunk}
+		}
+		return nil
+	case resp.StatusCode == http.StatusOK && offset > 0:
+		skipped, err := io.CopyN(ioutil.Discard, resp.Body, offset)
+		if err == io.EOF {
+			if skipped < offset {
+				return []error{ErrLogfileShrunk}
+			}
+		} else if err != nil {
+			return []error{err}
+		}
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent:
+		return []error{fmt.Errorf("downloading logfile %s: %s", logfile.ID, resp.Status)}
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+//WaitForRecipe polls a recipe until it has finished running or timeout
+//passes, returning its final state
+func WaitForRecipe(recipeid string, timeout time.Duration) (*Recipe, []error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		recipe, errs := GetRecipe(false, recipeid)
+
+		if errs != nil {
+			return nil, errs
+		}
+
+		if recipe.Status == RecipeStatusComplete || recipe.Status == RecipeStatusFailed {
+			return recipe, nil
+		}
+
+		if time.Now().After(deadline) {
+			return recipe, []error{fmt.Errorf("timed out waiting for recipe %s (%s)", recipeid, recipe.Status)}
+		}
+
+		time.Sleep(RecipePollInterval)
+	}
+}
@@ -0,0 +1,771 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package composeapitest provides an in-memory fake of the Compose 2016-07
+// API, for tests and offline development.
+//
+//	server := composeapitest.NewServer()
+//	defer server.Close()
+//	defer server.Install()()
+//
+// Install points composeapi at the fake until the function it returns is
+// called. Recipes started by the fake move from waiting to running to
+// complete as RecipeStepDuration passes on the API's Clock.
+package composeapitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+//Token is the API token the fake accepts unless API.Token is changed
+const Token = "composeapitest-token"
+
+//API is the state and handler of the fake. Its fields may be changed
+//before the first request; after that, use its methods.
+type API struct {
+	//Token is the bearer token requests must carry. Empty accepts any.
+	Token string
+	//RecipeStepDuration is how long a recipe is waiting, and then running,
+	//before it completes
+	RecipeStepDuration time.Duration
+	//Clock tells the time, for recipes' progress and new objects' dates.
+	//Tests can replace it to make output repeatable.
+	Clock func() time.Time
+
+	Account     composeapi.Account
+	User        composeapi.User
+	Clusters    []composeapi.Cluster
+	Datacenters []composeapi.Datacenter
+	Databases   []composeapi.Database
+	Teams       []composeapi.Team
+
+	mutex       sync.Mutex
+	nextid      int
+	order       []string
+	deployments map[string]*deployment
+	recipes     map[string]*recipe
+	failing     []string
+}
+
+type deployment struct {
+	composeapi.Deployment
+	scalings  composeapi.Scalings
+	backups   []composeapi.Backup
+	whitelist []composeapi.WhitelistEntry
+	teamroles []composeapi.TeamRole
+	recipeids []string
+	passwords map[string]string
+	alerts    composeapi.Alerts
+	logfiles  []*logfile
+}
+
+type logfile struct {
+	composeapi.Logfile
+	content []byte
+}
+
+type recipe struct {
+	composeapi.Recipe
+	fail bool
+}
+
+//NewAPI makes a fake with one account, user, cluster and team, two
+//datacenters, and MongoDB, PostgreSQL and Redis available
+func NewAPI() *API {
+	return &API{
+		Token:              Token,
+		RecipeStepDuration: 100 * time.Millisecond,
+		Clock:              time.Now,
+		Account:            composeapi.Account{ID: "account-1", Slug: "composeapitest", Name: "Compose API Test"},
+		User:               composeapi.User{ID: "user-1"},
+		Clusters: []composeapi.Cluster{{
+			ID:        "cluster-1",
+			AccountID: "account-1",
+			Name:      "test-cluster",
+			Type:      "private",
+			Provider:  "aws",
+			Region:    "us-east-1",
+			CreatedAt: time.Date(2016, 7, 1, 0, 0, 0, 0, time.UTC),
+			Subdomain: "test-cluster",
+		}},
+		Datacenters: []composeapi.Datacenter{
+			{Region: "us-east-1", Provider: "aws", Slug: "aws:us-east-1"},
+			{Region: "eu-west-1", Provider: "aws", Slug: "aws:eu-west-1"},
+		},
+		Databases: []composeapi.Database{
+			newDatabase("mongodb", "3.2.11", "3.4.1"),
+			newDatabase("postgresql", "9.5.5", "9.6.1"),
+			newDatabase("redis", "3.2.6"),
+		},
+		Teams:       []composeapi.Team{{ID: "team-1", Name: "developers"}},
+		deployments: map[string]*deployment{},
+		recipes:     map[string]*recipe{},
+	}
+}
+
+// newDatabase makes a database type whose last version is preferred
+func newDatabase(databasetype string, versions ...string) composeapi.Database {
+	database := composeapi.Database{DatabaseType: databasetype, Status: "available"}
+	for i, v := range versions {
+		database.Embedded.Versions = append(database.Embedded.Versions, composeapi.Version{
+			Application: databasetype,
+			Status:      "available",
+			Preferred:   i == len(versions)-1,
+			Version:     v,
+		})
+	}
+	return database
+}
+
+//Server serves an API over HTTP on a loopback address
+type Server struct {
+	*API
+	*httptest.Server
+}
+
+//NewServer starts serving a NewAPI
+func NewServer() *Server {
+	api := NewAPI()
+	return &Server{API: api, Server: httptest.NewServer(api)}
+}
+
+//Install points composeapi at the server, returning a function which points
+//it back where it was
+func (s *Server) Install() func() {
+	base, token := composeapi.APIBase, composeapi.APIToken
+	composeapi.APIBase = s.URL + "/"
+	composeapi.APIToken = s.Token
+	return func() {
+		composeapi.APIBase, composeapi.APIToken = base, token
+	}
+}
+
+//AddDeployment adds a deployment which is already provisioned, filling in an
+//ID, version and connection strings if they are missing
+func (a *API) AddDeployment(d composeapi.Deployment, units int) composeapi.Deployment {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.addDeployment(d, units).Deployment
+}
+
+//AddBackup adds a backup to a deployment
+func (a *API) AddBackup(deploymentid string, backup composeapi.Backup) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	d, ok := a.deployments[deploymentid]
+	if !ok {
+		return fmt.Errorf("no deployment %s", deploymentid)
+	}
+	if backup.ID == "" {
+		backup.ID = a.newID("backup")
+	}
+	backup.DeploymentID = deploymentid
+	d.backups = append(d.backups, backup)
+	return nil
+}
+
+//FailRecipes makes every recipe started on a deployment from now on fail
+//rather than complete
+func (a *API) FailRecipes(deploymentid string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, v := range a.recipes {
+		if v.DeploymentID == deploymentid && v.Status != composeapi.RecipeStatusComplete {
+			v.fail = true
+		}
+	}
+	a.failing = append(a.failing, deploymentid)
+}
+
+//Deployment returns the fake's current view of a deployment
+func (a *API) Deployment(id string) (composeapi.Deployment, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	d, ok := a.deployments[id]
+	if !ok {
+		return composeapi.Deployment{}, false
+	}
+	return d.Deployment, true
+}
+
+//AddLogfile adds a log file holding content to a deployment, filling in an
+//ID and date if they are missing
+func (a *API) AddLogfile(deploymentid string, l composeapi.Logfile, content []byte) (composeapi.Logfile, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	d, ok := a.deployments[deploymentid]
+	if !ok {
+		return composeapi.Logfile{}, fmt.Errorf("no deployment %s", deploymentid)
+	}
+	if l.ID == "" {
+		l.ID = a.newID("logfile")
+	}
+	if l.Date.IsZero() {
+		l.Date = a.now()
+	}
+	if l.Status == "" {
+		l.Status = "complete"
+	}
+	l.DeploymentID = deploymentid
+	l.DownloadLink = ""
+	d.logfiles = append(d.logfiles, &logfile{Logfile: l, content: content})
+	return l, nil
+}
+
+//AppendLogfile adds content to the end of a log file, as a capsule still
+//writing it would
+func (a *API) AppendLogfile(deploymentid string, logfileid string, content []byte) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if d, ok := a.deployments[deploymentid]; ok {
+		for _, v := range d.logfiles {
+			if v.ID == logfileid {
+				v.content = append(v.content, content...)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no logfile %s on deployment %s", logfileid, deploymentid)
+}
+
+//Password returns the password last set for a deployment's database user
+func (a *API) Password(deploymentid string, username string) (string, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	d, ok := a.deployments[deploymentid]
+	if !ok {
+		return "", false
+	}
+	password, ok := d.passwords[username]
+	return password, ok
+}
+
+//Alerts returns the fake's current alert settings for a deployment
+func (a *API) Alerts(deploymentid string) (composeapi.Alerts, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	d, ok := a.deployments[deploymentid]
+	if !ok {
+		return composeapi.Alerts{}, false
+	}
+	return d.alerts, true
+}
+
+func (a *API) now() time.Time {
+	if a.Clock == nil {
+		return time.Now().UTC()
+	}
+	return a.Clock().UTC()
+}
+
+func (a *API) newID(kind string) string {
+	a.nextid++
+	return fmt.Sprintf("%s-%d", kind, a.nextid)
+}
+
+func (a *API) addDeployment(d composeapi.Deployment, units int) *deployment {
+	if d.ID == "" {
+		d.ID = a.newID("deployment")
+	}
+	if d.Version == "" {
+		d.Version = a.preferredVersion(d.Type)
+	}
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = a.now()
+	}
+	if len(d.Connection.Direct) == 0 {
+		host := fmt.Sprintf("%s.composeapitest.local", d.Name)
+		// Like the API, leave a placeholder where the password goes
+		d.Connection.Direct = []string{fmt.Sprintf("%s://admin:[password]@%s:10000/", d.Type, host)}
+	}
+	d.Links.ComposeWebUILink = composeapi.Link{
+		HREF: fmt.Sprintf("https://app.compose.io/%s/deployments/%s", a.Account.Slug, d.Name),
+	}
+	if units == 0 {
+		units = 1
+	}
+
+	created := &deployment{
+		Deployment: d,
+		scalings: composeapi.Scalings{
+			AllocatedUnits: units,
+			UsedUnits:      1,
+			StartingUnits:  1,
+			MinimumUnits:   1,
+			UnitSizeInMB:   1024,
+			UnitType:       "memory",
+		},
+		whitelist: []composeapi.WhitelistEntry{},
+		teamroles: []composeapi.TeamRole{},
+		passwords: map[string]string{"admin": ""},
+		alerts:    composeapi.Alerts{DeploymentID: d.ID, Channels: []composeapi.AlertChannel{}},
+	}
+	a.deployments[d.ID] = created
+	a.order = append(a.order, d.ID)
+	return created
+}
+
+func (a *API) preferredVersion(databasetype string) string {
+	for _, database := range a.Databases {
+		if database.DatabaseType != databasetype {
+			continue
+		}
+		for _, v := range database.Embedded.Versions {
+			if v.Preferred {
+				return v.Version
+			}
+		}
+	}
+	return ""
+}
+
+// startRecipe records a recipe on d, which progresses as time passes
+func (a *API) startRecipe(d *deployment, name string) composeapi.Recipe {
+	r := &recipe{Recipe: composeapi.Recipe{
+		ID:           a.newID("recipe"),
+		Template:     name,
+		Name:         name,
+		Status:       composeapi.RecipeStatusWaiting,
+		AccountID:    a.Account.ID,
+		DeploymentID: d.ID,
+		CreatedAt:    a.now(),
+	}}
+	for _, v := range a.failing {
+		if v == d.ID {
+			r.fail = true
+		}
+	}
+	a.recipes[r.ID] = r
+	d.recipeids = append(d.recipeids, r.ID)
+	return a.recipeStatus(r)
+}
+
+// recipeStatus works out how far r has progressed
+func (a *API) recipeStatus(r *recipe) composeapi.Recipe {
+	current := r.Recipe
+	elapsed := a.now().Sub(r.CreatedAt)
+	switch {
+	case elapsed < a.RecipeStepDuration:
+		current.Status = composeapi.RecipeStatusWaiting
+	case elapsed < 2*a.RecipeStepDuration:
+		current.Status = composeapi.RecipeStatusRunning
+	case r.fail:
+		current.Status = composeapi.RecipeStatusFailed
+		current.StatusDetail = "failed by composeapitest"
+	default:
+		current.Status = composeapi.RecipeStatusComplete
+	}
+	return current
+}
+
+// downloadprefix starts the paths log files are downloaded from. Like the
+// presigned links the API gives out, they need no token.
+const downloadprefix = "/logfile-downloads/"
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if strings.HasPrefix(r.URL.Path, downloadprefix) {
+		a.downloadLogfile(w, r, strings.TrimPrefix(r.URL.Path, downloadprefix))
+		return
+	}
+
+	if a.Token != "" && r.Header.Get("Authorization") != "Bearer "+a.Token {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	var segments []string
+	if path := strings.Trim(r.URL.Path, "/"); path != "" {
+		segments = strings.Split(path, "/")
+	}
+	// Accept paths with or without the 2016-07 version prefix
+	if len(segments) > 0 && segments[0] == "2016-07" {
+		segments = segments[1:]
+	}
+	if len(segments) == 0 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	route := r.Method + " " + segments[0]
+	switch {
+	case route == "GET accounts" && len(segments) == 1:
+		writeJSON(w, http.StatusOK, embedded("accounts", []composeapi.Account{a.Account}))
+	case route == "GET user" && len(segments) == 1:
+		writeJSON(w, http.StatusOK, a.User)
+	case route == "GET clusters" && len(segments) == 1:
+		writeJSON(w, http.StatusOK, embedded("clusters", a.Clusters))
+	case route == "GET datacenters" && len(segments) == 1:
+		writeJSON(w, http.StatusOK, embedded("datacenters", a.Datacenters))
+	case route == "GET databases" && len(segments) == 1:
+		writeJSON(w, http.StatusOK, embedded("applications", a.Databases))
+	case route == "GET teams" && len(segments) == 1:
+		writeJSON(w, http.StatusOK, embedded("teams", a.Teams))
+	case route == "GET recipes" && len(segments) == 2:
+		rec, ok := a.recipes[segments[1]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "recipe not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, a.recipeStatus(rec))
+	case route == "GET deployments" && len(segments) == 1:
+		a.listDeployments(w)
+	case route == "POST deployments" && len(segments) == 1:
+		a.createDeployment(w, r)
+	case segments[0] == "deployments" && len(segments) >= 2:
+		d, ok := a.deployments[segments[1]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "deployment not found")
+			return
+		}
+		a.serveDeployment(w, r, d, segments[2:])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (a *API) listDeployments(w http.ResponseWriter) {
+	deployments := make([]composeapi.Deployment, 0, len(a.order))
+	for _, id := range a.order {
+		if d, ok := a.deployments[id]; ok {
+			deployments = append(deployments, d.Deployment)
+		}
+	}
+	writeJSON(w, http.StatusOK, embedded("deployments", deployments))
+}
+
+func (a *API) createDeployment(w http.ResponseWriter, r *http.Request) {
+	params := composeapi.CreateDeploymentParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch {
+	case params.Name == "":
+		writeError(w, http.StatusUnprocessableEntity, "name is required")
+		return
+	case params.AccountID != a.Account.ID:
+		writeError(w, http.StatusUnprocessableEntity, "unknown account")
+		return
+	case params.Datacenter == "" && params.ClusterID == "":
+		writeError(w, http.StatusUnprocessableEntity, "datacenter or cluster_id is required")
+		return
+	case a.preferredVersion(params.DatabaseType) == "":
+		writeError(w, http.StatusUnprocessableEntity, "unknown type "+params.DatabaseType)
+		return
+	}
+	for _, d := range a.deployments {
+		if d.Name == params.Name {
+			writeError(w, http.StatusUnprocessableEntity, "name is taken")
+			return
+		}
+	}
+
+	d := a.addDeployment(composeapi.Deployment{
+		Name:    params.Name,
+		Type:    params.DatabaseType,
+		Version: params.Version,
+	}, params.Units)
+	provision := a.startRecipe(d, "Provision")
+	d.ProvisionRecipeID = provision.ID
+
+	writeJSON(w, http.StatusAccepted, d.Deployment)
+}
+
+func (a *API) serveDeployment(w http.ResponseWriter, r *http.Request, d *deployment, segments []string) {
+	resource := ""
+	if len(segments) > 0 {
+		resource = segments[0]
+	}
+
+	switch r.Method + " " + resource {
+	case "GET ":
+		writeJSON(w, http.StatusOK, d.Deployment)
+	case "DELETE ":
+		rec := a.startRecipe(d, "Deprovision")
+		delete(a.deployments, d.ID)
+		writeJSON(w, http.StatusAccepted, rec)
+	case "GET recipes":
+		recipes := make([]composeapi.Recipe, 0, len(d.recipeids))
+		for _, id := range d.recipeids {
+			recipes = append(recipes, a.recipeStatus(a.recipes[id]))
+		}
+		writeJSON(w, http.StatusOK, embedded("recipes", recipes))
+	case "GET versions":
+		writeJSON(w, http.StatusOK, embedded("transitions", a.transitions(d)))
+	case "PATCH versions":
+		params := composeapi.UpdateVersionParams{}
+		if !readJSON(w, r, &params) {
+			return
+		}
+		allowed := false
+		for _, v := range a.transitions(d) {
+			allowed = allowed || v.ToVersion == params.Version
+		}
+		if !allowed {
+			writeError(w, http.StatusUnprocessableEntity, "no transition to "+params.Version)
+			return
+		}
+		d.Version = params.Version
+		writeJSON(w, http.StatusAccepted, a.startRecipe(d, "Upgrade"))
+	case "GET scalings":
+		writeJSON(w, http.StatusOK, d.scalings)
+	case "POST scalings":
+		params := composeapi.ScalingsParams{}
+		if !readJSON(w, r, &params) {
+			return
+		}
+		if params.Units < d.scalings.MinimumUnits {
+			writeError(w, http.StatusUnprocessableEntity, "units below minimum")
+			return
+		}
+		d.scalings.AllocatedUnits = params.Units
+		writeJSON(w, http.StatusAccepted, a.startRecipe(d, "Scale"))
+	case "GET backups":
+		writeJSON(w, http.StatusOK, embedded("backups", d.backups))
+	case "GET whitelist":
+		writeJSON(w, http.StatusOK, embedded("whitelist", d.whitelist))
+	case "POST whitelist":
+		params := composeapi.WhitelistParams{}
+		if !readJSON(w, r, &params) {
+			return
+		}
+		d.whitelist = append(d.whitelist, composeapi.WhitelistEntry{
+			ID:          a.newID("whitelist"),
+			IP:          params.IP,
+			Description: params.Description,
+		})
+		writeJSON(w, http.StatusAccepted, a.startRecipe(d, "AddWhitelist"))
+	case "DELETE whitelist":
+		if len(segments) != 2 {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		for i, v := range d.whitelist {
+			if v.ID == segments[1] {
+				d.whitelist = append(d.whitelist[:i], d.whitelist[i+1:]...)
+				writeJSON(w, http.StatusAccepted, a.startRecipe(d, "RemoveWhitelist"))
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "whitelist entry not found")
+	case "GET users":
+		users := make([]composeapi.DeploymentUser, 0, len(d.passwords))
+		for k := range d.passwords {
+			users = append(users, composeapi.DeploymentUser{Username: k})
+		}
+		sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+		writeJSON(w, http.StatusOK, embedded("users", users))
+	case "PATCH users":
+		if len(segments) != 2 {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		if _, ok := d.passwords[segments[1]]; !ok {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		params := composeapi.ChangePasswordParams{}
+		if !readJSON(w, r, &params) {
+			return
+		}
+		if params.Password == "" {
+			writeError(w, http.StatusUnprocessableEntity, "password is required")
+			return
+		}
+		d.passwords[segments[1]] = params.Password
+		writeJSON(w, http.StatusAccepted, a.startRecipe(d, "ChangePassword"))
+	case "GET alerts":
+		writeJSON(w, http.StatusOK, d.alerts)
+	case "PUT alerts":
+		params := composeapi.AlertsParams{}
+		if !readJSON(w, r, &params) {
+			return
+		}
+		if params.Channels == nil {
+			params.Channels = []composeapi.AlertChannel{}
+		}
+		d.alerts = composeapi.Alerts{DeploymentID: d.ID, Enabled: params.Enabled, Channels: params.Channels}
+		writeJSON(w, http.StatusOK, d.alerts)
+	case "GET logfiles":
+		if len(segments) == 1 {
+			logfiles := make([]composeapi.Logfile, 0, len(d.logfiles))
+			for _, v := range d.logfiles {
+				logfiles = append(logfiles, v.Logfile)
+			}
+			writeJSON(w, http.StatusOK, embedded("logfiles", logfiles))
+			return
+		}
+		for _, v := range d.logfiles {
+			if v.ID == segments[1] {
+				full := v.Logfile
+				full.DownloadLink = "http://" + r.Host + downloadprefix + d.ID + "/" + v.ID
+				writeJSON(w, http.StatusOK, full)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "logfile not found")
+	case "GET team_roles":
+		writeJSON(w, http.StatusOK, embedded("team_roles", d.teamroles))
+	case "POST team_roles":
+		params := composeapi.TeamRoleParams{}
+		if !readJSON(w, r, &params) {
+			return
+		}
+		a.addTeamRole(w, d, params)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (a *API) downloadLogfile(w http.ResponseWriter, r *http.Request, path string) {
+	ids := strings.Split(path, "/")
+	if d, ok := a.deployments[ids[0]]; ok && len(ids) == 2 && r.Method == "GET" {
+		for _, v := range d.logfiles {
+			if v.ID == ids[1] {
+				// Like S3, answer requests for a range of the file
+				w.Header().Set("Content-Type", "application/octet-stream")
+				http.ServeContent(w, r, v.Name, v.Date, bytes.NewReader(v.content))
+				return
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// transitions lists the versions d can be upgraded to, which for the fake
+// are any later than its current one
+func (a *API) transitions(d *deployment) []composeapi.VersionTransition {
+	transitions := []composeapi.VersionTransition{}
+	for _, database := range a.Databases {
+		if database.DatabaseType != d.Type {
+			continue
+		}
+		for _, v := range database.Embedded.Versions {
+			if compareVersions(v.Version, d.Version) > 0 && v.Status != "deprecated" {
+				transitions = append(transitions, composeapi.VersionTransition{
+					Application: d.Type,
+					Method:      "in_place",
+					FromVersion: d.Version,
+					ToVersion:   v.Version,
+				})
+			}
+		}
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		return compareVersions(transitions[i].ToVersion, transitions[j].ToVersion) < 0
+	})
+	return transitions
+}
+
+// compareVersions orders dotted versions part by part, numerically where
+// both parts are numbers, so that 3.10 comes after 3.2
+func compareVersions(a string, b string) int {
+	aparts, bparts := strings.Split(a, "."), strings.Split(b, ".")
+
+	for i := 0; i < len(aparts) || i < len(bparts); i++ {
+		if i >= len(aparts) {
+			return -1
+		}
+		if i >= len(bparts) {
+			return 1
+		}
+
+		anumber, aerr := strconv.Atoi(aparts[i])
+		bnumber, berr := strconv.Atoi(bparts[i])
+		switch {
+		case aerr == nil && berr == nil && anumber != bnumber:
+			if anumber < bnumber {
+				return -1
+			}
+			return 1
+		case (aerr != nil || berr != nil) && aparts[i] != bparts[i]:
+			if aparts[i] < bparts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (a *API) addTeamRole(w http.ResponseWriter, d *deployment, params composeapi.TeamRoleParams) {
+	var team *composeapi.Team
+	for i, v := range a.Teams {
+		if v.ID == params.TeamID {
+			team = &a.Teams[i]
+		}
+	}
+	if team == nil {
+		writeError(w, http.StatusUnprocessableEntity, "unknown team "+params.TeamID)
+		return
+	}
+
+	for i, v := range d.teamroles {
+		if v.Name == params.Name {
+			d.teamroles[i].Teams = append(d.teamroles[i].Teams, *team)
+			writeJSON(w, http.StatusCreated, d.teamroles[i])
+			return
+		}
+	}
+	role := composeapi.TeamRole{Name: params.Name, Teams: []composeapi.Team{*team}}
+	d.teamroles = append(d.teamroles, role)
+	writeJSON(w, http.StatusCreated, role)
+}
+
+// embedded wraps items the way HAL collections are returned
+func embedded(name string, items interface{}) map[string]interface{} {
+	return map[string]interface{}{"_embedded": map[string]interface{}{name: items}}
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, params interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/hal+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{"errors": map[string]string{"error": message}})
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeapitest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+// serve sends one request straight to api's handler
+func serve(api *API, method string, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+api.Token)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	return w
+}
+
+func TestServeHTTPRoutes(t *testing.T) {
+	api := NewAPI()
+	api.RecipeStepDuration = 0
+	d := api.AddDeployment(composeapi.Deployment{Name: "orders", Type: "postgresql"}, 1)
+	api.AddLogfile(d.ID, composeapi.Logfile{ID: "logfile-a", Name: "postgresql.log"}, []byte("started\n"))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"version prefix alone", "GET", "/2016-07", "", http.StatusNotFound, `"not found"`},
+		{"version prefix slash", "GET", "/2016-07/", "", http.StatusNotFound, `"not found"`},
+		{"root", "GET", "/", "", http.StatusNotFound, `"not found"`},
+		{"accounts", "GET", "/2016-07/accounts", "", http.StatusOK, `"slug":"composeapitest"`},
+		{"accounts without prefix", "GET", "/accounts", "", http.StatusOK, `"slug":"composeapitest"`},
+		{"unknown deployment", "GET", "/deployments/missing", "", http.StatusNotFound, `"deployment not found"`},
+		{"users", "GET", "/deployments/" + d.ID + "/users", "", http.StatusOK, `"username":"admin"`},
+		{"change unknown user", "PATCH", "/deployments/" + d.ID + "/users/nobody", `{"password":"x"}`, http.StatusNotFound, `"user not found"`},
+		{"change to empty password", "PATCH", "/deployments/" + d.ID + "/users/admin", `{"password":""}`, http.StatusUnprocessableEntity, `"password is required"`},
+		{"change password", "PATCH", "/deployments/" + d.ID + "/users/admin", `{"password":"hunter2"}`, http.StatusAccepted, `"template":"ChangePassword"`},
+		{"alerts", "GET", "/deployments/" + d.ID + "/alerts", "", http.StatusOK, `"channels":[]`},
+		{"update alerts", "PUT", "/deployments/" + d.ID + "/alerts", `{"enabled":true,"channels":[{"type":"sms","target":"+15555550100"}]}`, http.StatusOK, `"target":"+15555550100"`},
+		{"logfiles", "GET", "/deployments/" + d.ID + "/logfiles", "", http.StatusOK, `"download_link":""`},
+		{"logfile", "GET", "/deployments/" + d.ID + "/logfiles/logfile-a", "", http.StatusOK, `"download_link":"http://example.com/logfile-downloads/` + d.ID + `/logfile-a"`},
+		{"unknown logfile", "GET", "/deployments/" + d.ID + "/logfiles/missing", "", http.StatusNotFound, `"logfile not found"`},
+		{"download", "GET", "/logfile-downloads/" + d.ID + "/logfile-a", "", http.StatusOK, "started\n"},
+		{"download unknown", "GET", "/logfile-downloads/" + d.ID + "/missing", "", http.StatusNotFound, "not found"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serve(api, test.method, test.path, test.body)
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d", w.Code, test.status)
+			}
+			if !strings.Contains(w.Body.String(), test.want) {
+				t.Errorf("body %s, want it to contain %s", w.Body, test.want)
+			}
+		})
+	}
+
+	if password, _ := api.Password(d.ID, "admin"); password != "hunter2" {
+		t.Errorf("password %q, want hunter2", password)
+	}
+	if alerts, _ := api.Alerts(d.ID); !alerts.Enabled || len(alerts.Channels) != 1 {
+		t.Errorf("alerts %+v", alerts)
+	}
+}
+
+func TestServeHTTPNeedsToken(t *testing.T) {
+	api := NewAPI()
+	req := httptest.NewRequest("GET", "/accounts", nil)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"3.2", "3.2", 0},
+		{"3.10", "3.2", 1},
+		{"3.2", "3.10", -1},
+		{"3.2.11", "3.2.9", 1},
+		{"3.4", "3.4.1", -1},
+		{"10.0", "9.6.1", 1},
+		{"3.0-rc1", "3.0-rc2", -1},
+	}
+
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestVersionsOrderedNumerically(t *testing.T) {
+	api := NewAPI()
+	api.Databases = []composeapi.Database{newDatabase("mongodb", "3.2.9", "3.10.0", "3.2.11", "3.4.1")}
+	d := api.AddDeployment(composeapi.Deployment{Name: "catalog", Type: "mongodb", Version: "3.2.9"}, 1)
+
+	w := serve(api, "GET", "/deployments/"+d.ID+"/versions", "")
+	response := composeapi.VersionsResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range response.Embedded.VersionTransitions {
+		got = append(got, v.ToVersion)
+	}
+	if want := []string{"3.2.11", "3.4.1", "3.10.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("transitions to %v, want %v", got, want)
+	}
+}
+
+func TestRecipesProgressWithClock(t *testing.T) {
+	now := time.Date(2016, 7, 4, 12, 0, 0, 0, time.UTC)
+	api := NewAPI()
+	api.Clock = func() time.Time { return now }
+	api.RecipeStepDuration = time.Minute
+	d := api.AddDeployment(composeapi.Deployment{Name: "orders", Type: "postgresql"}, 1)
+
+	w := serve(api, "POST", "/deployments/"+d.ID+"/scalings", `{"units":2}`)
+	recipe := composeapi.Recipe{}
+	json.NewDecoder(w.Body).Decode(&recipe)
+
+	for _, step := range []string{composeapi.RecipeStatusWaiting, composeapi.RecipeStatusRunning, composeapi.RecipeStatusComplete} {
+		w := serve(api, "GET", "/recipes/"+recipe.ID, "")
+		body, _ := ioutil.ReadAll(w.Body)
+		if !strings.Contains(string(body), `"status":"`+step+`"`) {
+			t.Errorf("recipe %s, want %s", body, step)
+		}
+		now = now.Add(time.Minute)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command fakecompose serves the composeapitest fake of the Compose API, so
+// cocli can be run without an account or network access:
+//
+//	go run ./composeapi/composeapitest/fakecompose &
+//	COMPOSEAPIURL=http://localhost:9341/ COMPOSEAPITOKEN=composeapitest-token cocli show deployments
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+	"github.com/compose/cocli/composeapi/composeapitest"
+)
+
+func main() {
+	listen := flag.String("listen", "localhost:9341", "Address to serve the fake API on")
+	token := flag.String("token", composeapitest.Token, "API token to accept (empty accepts any)")
+	seed := flag.Bool("seed", true, "Start with an example deployment of each database type")
+	flag.Parse()
+
+	api := composeapitest.NewAPI()
+	api.Token = *token
+	api.RecipeStepDuration = 5 * time.Second
+
+	if *seed {
+		for _, v := range api.Databases {
+			d := api.AddDeployment(composeapi.Deployment{Name: "example-" + v.DatabaseType, Type: v.DatabaseType}, 1)
+			api.AddBackup(d.ID, composeapi.Backup{
+				Name:      "Daily backup",
+				Type:      "scheduled",
+				Status:    "complete",
+				CreatedAt: time.Now().UTC().Add(-6 * time.Hour),
+			})
+			api.AddLogfile(d.ID, composeapi.Logfile{
+				Name:      v.DatabaseType + ".log",
+				CapsuleID: "capsule-1",
+				Region:    "us-east-1",
+			}, []byte("example log line\n"))
+		}
+	}
+
+	log.Printf("Serving fake Compose API on http://%s/", *listen)
+	log.Fatal(http.ListenAndServe(*listen, api))
+}
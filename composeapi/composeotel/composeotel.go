@@ -0,0 +1,156 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package composeotel traces API calls with OpenTelemetry. Add its
+// Middleware to give every call a client span:
+//
+//	composeapi.Use(composeotel.Middleware)
+//
+// Added after composeapi.Retry, each retry gets a span of its own.
+//
+// Spans go to the global TracerProvider unless one is given, so nothing is
+// exported until the program installs an SDK and exporter, such as OTLP.
+// Spans carry the endpoint template, status code, resend count and, where the
+// response names one, the recipe the call started.
+package composeotel
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/compose/cocli/composeapi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//InstrumentationName names the tracer spans are made with
+const InstrumentationName = "github.com/compose/cocli/composeapi/composeotel"
+
+// Span attributes. The HTTP ones follow the OpenTelemetry semantic
+// conventions.
+const (
+	AttributeMethod      = attribute.Key("http.request.method")
+	AttributeStatusCode  = attribute.Key("http.response.status_code")
+	AttributeURL         = attribute.Key("url.full")
+	AttributeEndpoint    = attribute.Key("compose.endpoint")
+	AttributeResendCount = attribute.Key("http.request.resend_count")
+	AttributeRecipeID    = attribute.Key("compose.recipe_id")
+)
+
+//Transport is an http.RoundTripper which traces each call it passes on to
+//Next
+type Transport struct {
+	//Next makes the calls. Nil uses http.DefaultTransport.
+	Next http.RoundTripper
+	//TracerProvider makes the tracer. Nil uses otel.GetTracerProvider().
+	TracerProvider trace.TracerProvider
+	//Propagator injects the span into request headers. Nil uses
+	//otel.GetTextMapPropagator().
+	Propagator propagation.TextMapPropagator
+}
+
+//NewTransport traces calls made through next with the global
+//TracerProvider
+func NewTransport(next http.RoundTripper) *Transport {
+	return &Transport{Next: next}
+}
+
+//Middleware traces calls with the global TracerProvider, for composeapi.Use
+func Middleware(next http.RoundTripper) http.RoundTripper {
+	return NewTransport(next)
+}
+
+//RoundTrip makes a call inside a span
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	provider := t.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	propagator := t.Propagator
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+
+	endpoint := composeapi.EndpointTemplate(strings.TrimPrefix(req.URL.String(), composeapi.APIBase))
+	ctx, span := provider.Tracer(InstrumentationName).Start(req.Context(),
+		fmt.Sprintf("%s %s", req.Method, endpoint),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			AttributeMethod.String(req.Method),
+			AttributeURL.String(composeapi.RedactURL(req.URL.String())),
+			AttributeEndpoint.String(endpoint),
+		))
+	defer span.End()
+
+	if retries := composeapi.RetryCount(req.Context()); retries > 0 {
+		span.SetAttributes(AttributeResendCount.Int(retries))
+	}
+
+	// RoundTrippers mustn't change the request they're given
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(AttributeStatusCode.Int(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	if recipeid := recipeID(resp); recipeid != "" {
+		span.SetAttributes(AttributeRecipeID.String(recipeid))
+	}
+
+	return resp, nil
+}
+
+// recipeID finds the recipe a call started or asked about in its JSON
+// response, leaving the body unread for the caller
+func recipeID(resp *http.Response) string {
+	if resp.Body == nil || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return ""
+	}
+	body, err := composeapi.ReadBody(&resp.Body)
+	if err != nil {
+		return ""
+	}
+
+	fields := struct {
+		ID                string `json:"id"`
+		Template          string `json:"template"`
+		ProvisionRecipeID string `json:"provision_recipe_id"`
+	}{}
+	if json.Unmarshal([]byte(body), &fields) != nil {
+		return ""
+	}
+
+	if fields.Template != "" {
+		// The response is a recipe
+		return fields.ID
+	}
+	return fields.ProvisionRecipeID
+}
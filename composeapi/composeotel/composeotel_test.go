@@ -0,0 +1,175 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeotel_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+	"github.com/compose/cocli/composeapi/composeapitest"
+	"github.com/compose/cocli/composeapi/composeotel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// failFirst answers the first call to path with 503 Service Unavailable
+func failFirst(path string) composeapi.Middleware {
+	failed := false
+	return func(next http.RoundTripper) http.RoundTripper {
+		return composeapi.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == path && !failed {
+				failed = true
+				return &http.Response{
+					Status:     "503 Service Unavailable",
+					StatusCode: http.StatusServiceUnavailable,
+					Header:     http.Header{},
+					Body:       http.NoBody,
+					Request:    req,
+				}, nil
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// wantSpan is what a recorded span should be
+type wantSpan struct {
+	name       string
+	endpoint   string
+	status     int
+	retries    int
+	recipeid   string
+	statuscode codes.Code
+}
+
+func TestSpans(t *testing.T) {
+	server := composeapitest.NewServer()
+	defer server.Close()
+	defer server.Install()()
+	deployment := server.AddDeployment(composeapi.Deployment{ID: "deployment-orders", Name: "orders", Type: "postgresql"}, 1)
+
+	tests := []struct {
+		name  string
+		call  func() (string, []error)
+		spans []wantSpan
+	}{
+		{
+			"get",
+			func() (string, []error) { return composeapi.GetDeploymentJSON(deployment.ID) },
+			[]wantSpan{{"GET deployments/:id", "deployments/:id", 200, 0, "", codes.Unset}},
+		},
+		{
+			"recipe started",
+			func() (string, []error) {
+				recipe, errs := composeapi.SetScalingsForDeployment(deployment.ID, composeapi.ScalingsParams{Units: 2})
+				if errs != nil {
+					return "", errs
+				}
+				return recipe.ID, nil
+			},
+			[]wantSpan{{"POST deployments/:id/scalings", "deployments/:id/scalings", 202, 0, "recipe", codes.Unset}},
+		},
+		{
+			"deployment provisioned",
+			func() (string, []error) {
+				d, errs := composeapi.CreateDeployment(composeapi.CreateDeploymentParams{
+					Name:         "sessions",
+					AccountID:    "account-1",
+					Datacenter:   "aws:us-east-1",
+					DatabaseType: "redis",
+				})
+				if errs != nil {
+					return "", errs
+				}
+				return d.ProvisionRecipeID, nil
+			},
+			[]wantSpan{{"POST deployments", "deployments", 202, 0, "recipe", codes.Unset}},
+		},
+		{
+			"retried",
+			func() (string, []error) { return composeapi.GetUsersForDeploymentJSON(deployment.ID) },
+			[]wantSpan{
+				{"GET deployments/:id/users", "deployments/:id/users", 503, 0, "", codes.Error},
+				{"GET deployments/:id/users", "deployments/:id/users", 200, 1, "", codes.Unset},
+			},
+		},
+		{
+			"error status",
+			func() (string, []error) { return composeapi.GetRecipeJSON("missing") },
+			[]wantSpan{{"GET recipes/:id", "recipes/:id", 404, 0, "", codes.Error}},
+		},
+	}
+
+	previous := composeapi.Transport
+	defer func() { composeapi.Transport = previous }()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			// Tracing inside Retry gives each attempt a span
+			composeapi.Transport = composeapi.Chain(nil,
+				composeapi.Retry(1, time.Millisecond),
+				func(next http.RoundTripper) http.RoundTripper {
+					return &composeotel.Transport{Next: next, TracerProvider: provider}
+				},
+				failFirst("/deployments/"+deployment.ID+"/users"))
+
+			recipeid, errs := test.call()
+			if errs != nil {
+				t.Fatal(errs)
+			}
+
+			spans := recorder.Ended()
+			if len(spans) != len(test.spans) {
+				t.Fatalf("recorded %d spans, want %d", len(spans), len(test.spans))
+			}
+			for i, want := range test.spans {
+				span := spans[i]
+				attributes := map[attribute.Key]attribute.Value{}
+				for _, v := range span.Attributes() {
+					attributes[v.Key] = v.Value
+				}
+
+				if span.Name() != want.name {
+					t.Errorf("span %d name %q, want %q", i, span.Name(), want.name)
+				}
+				if got := attributes[composeotel.AttributeEndpoint].AsString(); got != want.endpoint {
+					t.Errorf("span %d endpoint %q, want %q", i, got, want.endpoint)
+				}
+				if got := attributes[composeotel.AttributeStatusCode].AsInt64(); got != int64(want.status) {
+					t.Errorf("span %d status %d, want %d", i, got, want.status)
+				}
+				if got := attributes[composeotel.AttributeResendCount].AsInt64(); got != int64(want.retries) {
+					t.Errorf("span %d retry count %d, want %d", i, got, want.retries)
+				}
+				wantrecipe := ""
+				if want.recipeid != "" {
+					wantrecipe = recipeid
+				}
+				if got := attributes[composeotel.AttributeRecipeID].AsString(); got != wantrecipe {
+					t.Errorf("span %d recipe %q, want %q", i, got, wantrecipe)
+				}
+				if got := span.Status().Code; got != want.statuscode {
+					t.Errorf("span %d status code %s, want %s", i, got, want.statuscode)
+				}
+			}
+		})
+	}
+}
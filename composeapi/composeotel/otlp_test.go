@@ -0,0 +1,171 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeotel_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+	"github.com/compose/cocli/composeapi/composeapitest"
+	"github.com/compose/cocli/composeapi/composeotel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector stands in for an OTLP/HTTP collector, keeping the spans it is
+// sent
+type collector struct {
+	mutex sync.Mutex
+	spans []*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request := &coltracepb.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(body, request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mutex.Lock()
+	for _, resource := range request.ResourceSpans {
+		for _, scope := range resource.ScopeSpans {
+			c.spans = append(c.spans, scope.Spans...)
+		}
+	}
+	c.mutex.Unlock()
+
+	response, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(response)
+}
+
+func TestOTLPExport(t *testing.T) {
+	server := composeapitest.NewServer()
+	defer server.Close()
+	defer server.Install()()
+	deployment := server.AddDeployment(composeapi.Deployment{ID: "deployment-orders", Name: "orders", Type: "postgresql"}, 1)
+
+	received := &collector{}
+	collectorserver := httptest.NewServer(received)
+	defer collectorserver.Close()
+
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpoint(strings.TrimPrefix(collectorserver.URL, "http://")),
+		otlptracehttp.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+
+	previous := composeapi.Transport
+	defer func() { composeapi.Transport = previous }()
+	composeapi.Transport = composeapi.Chain(nil,
+		composeapi.Retry(1, time.Millisecond),
+		func(next http.RoundTripper) http.RoundTripper {
+			return &composeotel.Transport{Next: next, TracerProvider: provider}
+		},
+		failFirst("/deployments/"+deployment.ID+"/scalings"))
+
+	if _, errs := composeapi.GetScalingsForDeploymentJSON(deployment.ID); errs != nil {
+		t.Fatal(errs)
+	}
+	recipe, errs := composeapi.SetScalingsForDeployment(deployment.ID, composeapi.ScalingsParams{Units: 2})
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	// Shutting down flushes every span to the collector
+	if err := provider.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	url := composeapi.APIBase + "deployments/" + deployment.ID + "/scalings"
+	want := []map[string]string{
+		{
+			"name":                                  "GET deployments/:id/scalings",
+			"status":                                "error",
+			string(composeotel.AttributeMethod):     "GET",
+			string(composeotel.AttributeURL):        url,
+			string(composeotel.AttributeEndpoint):   "deployments/:id/scalings",
+			string(composeotel.AttributeStatusCode): "503",
+		},
+		{
+			"name":                                   "GET deployments/:id/scalings",
+			"status":                                 "unset",
+			string(composeotel.AttributeMethod):      "GET",
+			string(composeotel.AttributeURL):         url,
+			string(composeotel.AttributeEndpoint):    "deployments/:id/scalings",
+			string(composeotel.AttributeStatusCode):  "200",
+			string(composeotel.AttributeResendCount): "1",
+		},
+		{
+			"name":                                  "POST deployments/:id/scalings",
+			"status":                                "unset",
+			string(composeotel.AttributeMethod):     "POST",
+			string(composeotel.AttributeURL):        url,
+			string(composeotel.AttributeEndpoint):   "deployments/:id/scalings",
+			string(composeotel.AttributeStatusCode): "202",
+			string(composeotel.AttributeRecipeID):   recipe.ID,
+		},
+	}
+
+	received.mutex.Lock()
+	defer received.mutex.Unlock()
+	var got []map[string]string
+	for _, span := range received.spans {
+		if span.Kind != tracepb.Span_SPAN_KIND_CLIENT {
+			t.Errorf("%s is a %s span", span.Name, span.Kind)
+		}
+		attributes := map[string]string{"name": span.Name, "status": "unset"}
+		if span.Status.GetCode() == tracepb.Status_STATUS_CODE_ERROR {
+			attributes["status"] = "error"
+		}
+		for _, v := range span.Attributes {
+			switch value := v.Value.Value.(type) {
+			case *commonpb.AnyValue_StringValue:
+				attributes[v.Key] = value.StringValue
+			case *commonpb.AnyValue_IntValue:
+				attributes[v.Key] = strconv.FormatInt(value.IntValue, 10)
+			}
+		}
+		got = append(got, attributes)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collector received\n%v\nwant\n%v", got, want)
+	}
+}
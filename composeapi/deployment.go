@@ -26,6 +26,7 @@ type Deployment struct {
 	ID                  string            `json:"id"`
 	Name                string            `json:"name"`
 	Type                string            `json:"type"`
+	Version             string            `json:"version"`
 	CreatedAt           time.Time         `json:"created_at"`
 	ProvisionRecipeID   string            `json:"provision_recipe_id"`
 	CACertificateBase64 string            `json:"ca_certificate_base64"`
@@ -54,15 +55,18 @@ type DeploymentsResponse struct {
 
 //CreateDeploymentParams Parameters to be completed before creating a deployment
 type CreateDeploymentParams struct {
-	Name         string `json:"name"`
-	AccountID    string `json:"account_id"`
-	ClusterID    string `json:"cluster_id,omitempty"`
-	Datacenter   string `json:"datacenter,omitempty"`
-	DatabaseType string `json:"type"`
-	Version      string `json:"version,omitempty"`
-	Units        int    `json:"units,omitempty"`
-	SSL          bool   `json:"ssl,omitempty"`
-	WiredTiger   bool   `json:"wired_tiger,omitempty"`
+	Name         string   `json:"name" yaml:"name"`
+	AccountID    string   `json:"account_id" yaml:"account_id"`
+	ClusterID    string   `json:"cluster_id,omitempty" yaml:"cluster_id,omitempty"`
+	Datacenter   string   `json:"datacenter,omitempty" yaml:"datacenter,omitempty"`
+	DatabaseType string   `json:"type" yaml:"type"`
+	Version      string   `json:"version,omitempty" yaml:"version,omitempty"`
+	Units        int      `json:"units,omitempty" yaml:"units,omitempty"`
+	SSL          bool     `json:"ssl,omitempty" yaml:"ssl,omitempty"`
+	WiredTiger   bool     `json:"wired_tiger,omitempty" yaml:"wired_tiger,omitempty"`
+	CacheMode    bool     `json:"cache_mode,omitempty" yaml:"cache_mode,omitempty"`
+	Notes        string   `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Tags         []string `json:"tags,omitempty" yaml:"tags,omitempty"`
 }
 
 //VersionTransition a struct wrapper for version transition information
@@ -73,9 +77,31 @@ type VersionTransition struct {
 	ToVersion   string `json:"to_version"`
 }
 
+//UpdateVersionParams Parameters to be completed before upgrading a deployment
+type UpdateVersionParams struct {
+	Version string `json:"version"`
+}
+
 //VersionsResponse Version holding structure
 type VersionsResponse struct {
 	Embedded struct {
 		VersionTransitions []VersionTransition `json:"transitions"`
 	} `json:"_embedded"`
 }
+
+//DeploymentUser a database user of a deployment
+type DeploymentUser struct {
+	Username string `json:"username"`
+}
+
+//DeploymentUsersResponse DeploymentUser holding structure
+type DeploymentUsersResponse struct {
+	Embedded struct {
+		Users []DeploymentUser `json:"users"`
+	} `json:"_embedded"`
+}
+
+//ChangePasswordParams Parameters for changing a deployment user's password
+type ChangePasswordParams struct {
+	Password string `json:"password"`
+}
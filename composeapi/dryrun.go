@@ -0,0 +1,55 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	//DryRun makes calls which would change anything print the request they
+	//would send to DryRunOutput instead, with secrets redacted. Calls which only read still run.
+	DryRun = false
+
+	//DryRunOutput is where requests are printed in DryRun mode
+	DryRunOutput io.Writer = os.Stdout
+
+	//ErrDryRun is returned by calls which were printed rather than sent
+	ErrDryRun = errors.New("dry run: request not sent")
+)
+
+//IsDryRun reports whether errs is the result of a call skipped by DryRun
+func IsDryRun(errs []error) bool {
+	return len(errs) == 1 && errs[0] == ErrDryRun
+}
+
+func printDryRun(method string, endpoint string, params interface{}) []error {
+	fmt.Fprintf(DryRunOutput, "%s %s\n", method, APIBase+endpoint)
+
+	if params != nil {
+		// Printed requests end up in CI logs, so carry no secrets
+		body, err := json.MarshalIndent(RedactParams(params), "", " ")
+		if err != nil {
+			return []error{err}
+		}
+		fmt.Fprintf(DryRunOutput, "%s\n", body)
+	}
+
+	return []error{ErrDryRun}
+}
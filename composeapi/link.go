@@ -0,0 +1,73 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeapi
+
+import (
+	"net/url"
+	"strings"
+)
+
+//Expand expands a templated HREF with vars. Only the simple {var} and
+//query {?var,...} forms used by the Compose API are supported; variables
+//which are not in vars are dropped.
+func (link Link) Expand(vars map[string]string) string {
+	if !link.Templated && !strings.Contains(link.HREF, "{") {
+		return link.HREF
+	}
+
+	expanded := ""
+	rest := link.HREF
+	for {
+		start := strings.Index(rest, "{")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end == -1 {
+			break
+		}
+		expanded += rest[:start]
+		expanded += expandExpression(rest[start+1:start+end], vars)
+		rest = rest[start+end+1:]
+	}
+
+	return expanded + rest
+}
+
+func expandExpression(expression string, vars map[string]string) string {
+	query := strings.HasPrefix(expression, "?")
+	expression = strings.TrimPrefix(expression, "?")
+
+	var parts []string
+	for _, name := range strings.Split(expression, ",") {
+		value, ok := vars[name]
+		if !ok {
+			continue
+		}
+		if query {
+			parts = append(parts, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		} else {
+			parts = append(parts, url.PathEscape(value))
+		}
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	if query {
+		return "?" + strings.Join(parts, "&")
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,241 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeapi
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Middleware wraps next, adding behaviour to every call made through it
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+//RoundTripperFunc lets a function be used as an http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+//RoundTrip calls f
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+//ReadBody reads a request or response body, leaving an unread copy in its
+//place, for middleware which logs or records calls
+func ReadBody(body *io.ReadCloser) (string, error) {
+	if *body == nil {
+		return "", nil
+	}
+	data, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return "", err
+	}
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+	return string(data), nil
+}
+
+var (
+	middlewaremutex sync.RWMutex
+	middlewares     []*Middleware
+)
+
+//Use adds middleware to the chain every call passes through on its way to
+//Transport, returning a function which removes it again. Calls pass through
+//middleware in the order it was added, so the first added sees each call
+//first. The API token is added to calls before any middleware runs, so
+//middleware sees calls as they are sent and may replace their
+//Authorization header.
+//
+//Middleware sees every HTTP request, retries included, which suits tracing
+//and logging. Transport is for whatever finally carries calls, such as a
+//proxy or a recording. Observers added with AddCallObserver are told about
+//API calls instead, once each has finished.
+func Use(middleware ...Middleware) (remove func()) {
+	middlewaremutex.Lock()
+	defer middlewaremutex.Unlock()
+
+	added := make([]*Middleware, len(middleware))
+	for i := range middleware {
+		added[i] = &middleware[i]
+	}
+	middlewares = append(middlewares, added...)
+
+	return func() {
+		middlewaremutex.Lock()
+		defer middlewaremutex.Unlock()
+
+		kept := []*Middleware{}
+		for _, v := range middlewares {
+			if !containsMiddleware(added, v) {
+				kept = append(kept, v)
+			}
+		}
+		middlewares = kept
+	}
+}
+
+func containsMiddleware(list []*Middleware, middleware *Middleware) bool {
+	for _, v := range list {
+		if v == middleware {
+			return true
+		}
+	}
+	return false
+}
+
+//Chain wraps transport in middleware, the first outermost. A nil transport
+//is http.DefaultTransport.
+func Chain(transport http.RoundTripper, middleware ...Middleware) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		transport = middleware[i](transport)
+	}
+	return transport
+}
+
+// client makes calls through the middleware added with Use and Transport
+func client() *http.Client {
+	middlewaremutex.RLock()
+	chain := []Middleware{authorize}
+	for _, v := range middlewares {
+		chain = append(chain, *v)
+	}
+	middlewaremutex.RUnlock()
+
+	return &http.Client{Transport: Chain(Transport, chain...)}
+}
+
+// authorize adds APIToken to calls to the API. Other calls, such as logfile
+// downloads, carry their own credentials.
+func authorize(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Authorization") != "" || !strings.HasPrefix(req.URL.String(), APIBase) {
+			return next.RoundTrip(req)
+		}
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+APIToken)
+		return next.RoundTrip(req)
+	})
+}
+
+//Retry retries calls which fail or which the API answers with 429 Too Many
+//Requests or a 5xx status, up to retries times, waiting backoff before the
+//first retry and doubling the wait each time after. A Retry-After header
+//from the API overrides the wait. Only calls which are safe to repeat are
+//retried after an error or a 5xx status, as a POST might have taken effect.
+//Each retry's context records its count for RetryCount.
+func Retry(retries int, backoff time.Duration) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			wait := backoff
+			for attempt := 0; ; attempt++ {
+				attemptreq := req
+				if attempt > 0 {
+					attemptreq = req.Clone(WithRetryCount(req.Context(), attempt))
+					// shouldRetry checked the body can be sent again
+					if req.Body != nil {
+						body, err := req.GetBody()
+						if err != nil {
+							return nil, err
+						}
+						attemptreq.Body = body
+					}
+				}
+
+				resp, err := next.RoundTrip(attemptreq)
+				if attempt == retries || !shouldRetry(req, resp, err) {
+					return resp, err
+				}
+
+				delay := wait
+				if resp != nil {
+					if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+						delay = time.Duration(seconds) * time.Second
+					}
+					resp.Body.Close()
+				}
+
+				select {
+				case <-time.After(delay):
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				}
+				wait *= 2
+			}
+		})
+	}
+}
+
+// shouldRetry decides whether a call's result is worth another try
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		return idempotent[req.Method] && req.Context().Err() == nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return idempotent[req.Method] && resp.StatusCode >= 500
+}
+
+// idempotent methods can be repeated without changing their effect
+var idempotent = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"PUT":     true,
+	"DELETE":  true,
+}
+
+//RateLimit spaces calls at least interval apart, across every chain the
+//returned Middleware is used in
+func RateLimit(interval time.Duration) Middleware {
+	var mutex sync.Mutex
+	var next time.Time
+
+	// reserve returns when the caller may go
+	reserve := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		now := time.Now()
+		if next.Before(now) {
+			next = now
+		}
+		slot := next
+		next = next.Add(interval)
+		return slot
+	}
+
+	return func(transport http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			select {
+			case <-time.After(time.Until(reserve())):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+			return transport.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeapi
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Call describes an API call once it has completed
+type Call struct {
+	Method string
+	// Endpoint is the endpoint template, with IDs replaced by :id
+	Endpoint string
+	// Path is the endpoint as called
+	Path       string
+	Params     interface{}
+	StatusCode int
+	Body       string
+	Duration   time.Duration
+	// Errors is ErrDryRun for calls DryRun skipped
+	Errors []error
+}
+
+//CallObserver is told about every API call
+type CallObserver func(call Call)
+
+var (
+	observersmutex sync.RWMutex
+	observers      []*CallObserver
+)
+
+// collections are the endpoint segments which are followed by an ID
+var collections = map[string]bool{
+	"deployments": true,
+	"recipes":     true,
+	"logfiles":    true,
+	"whitelist":   true,
+	"teams":       true,
+	"users":       true,
+	"backups":     true,
+	"clusters":    true,
+}
+
+//AddCallObserver registers observer to be told about every API call,
+//returning a function which unregisters it. Unlike middleware added with
+//Use, observers see each call once, after any retries, with the parameters
+//it was made with and the errors it returned, which is what metrics and
+//audit logs count.
+func AddCallObserver(observer CallObserver) (remove func()) {
+	observersmutex.Lock()
+	defer observersmutex.Unlock()
+
+	added := &observer
+	observers = append(observers, added)
+
+	return func() {
+		observersmutex.Lock()
+		defer observersmutex.Unlock()
+
+		kept := []*CallObserver{}
+		for _, v := range observers {
+			if v != added {
+				kept = append(kept, v)
+			}
+		}
+		observers = kept
+	}
+}
+
+func notifyCall(method string, endpoint string, params interface{}, start time.Time, statuscode int, body string, errs []error) {
+	// Observers may make API calls of their own, so don't hold the lock
+	// while they run
+	observersmutex.RLock()
+	current := observers
+	observersmutex.RUnlock()
+
+	if len(current) == 0 {
+		return
+	}
+
+	call := Call{
+		Method:     method,
+		Endpoint:   EndpointTemplate(endpoint),
+		Path:       endpoint,
+		Params:     params,
+		StatusCode: statuscode,
+		Body:       body,
+		Duration:   time.Since(start),
+		Errors:     errs,
+	}
+	for _, observer := range current {
+		(*observer)(call)
+	}
+}
+
+//EndpointTemplate replaces the IDs in an endpoint with :id, so that calls
+//to the same endpoint for different deployments can be grouped together
+func EndpointTemplate(endpoint string) string {
+	segments := strings.Split(strings.SplitN(endpoint, "?", 2)[0], "/")
+
+	for i := 1; i < len(segments); i++ {
+		if collections[segments[i-1]] && segments[i] != "" {
+			segments[i] = ":id"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+type retrycountkey struct{}
+
+//WithRetryCount returns a copy of ctx recording that a request is a retry,
+//the retries'th, of an earlier failed call
+func WithRetryCount(ctx context.Context, retries int) context.Context {
+	return context.WithValue(ctx, retrycountkey{}, retries)
+}
+
+//RetryCount reports how many times the call a request's context belongs to
+//has been retried
+func RetryCount(ctx context.Context) int {
+	retries, _ := ctx.Value(retrycountkey{}).(int)
+	return retries
+}
@@ -0,0 +1,253 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+//Change is one operation towards a manifest
+type Change interface {
+	//Deployment is the name of the deployment changed
+	Deployment() string
+	//DeploymentID is the ID of the deployment changed, or empty if it has
+	//yet to be created
+	DeploymentID() string
+	//Symbol is + for additions, ~ for changes and - for removals
+	Symbol() string
+	String() string
+	//Apply starts the change on the deployment with deploymentid, returning
+	//the recipe to wait for. The recipe's ID is empty if there is nothing
+	//to wait for.
+	Apply(deploymentid string) (*composeapi.Recipe, []error)
+}
+
+//Create creates a deployment
+type Create struct {
+	Params composeapi.CreateDeploymentParams
+}
+
+//Deployment returns the deployment name
+func (c Create) Deployment() string { return c.Params.Name }
+
+//DeploymentID is always empty, as the deployment doesn't exist yet
+func (c Create) DeploymentID() string { return "" }
+
+//Symbol returns +
+func (c Create) Symbol() string { return "+" }
+
+func (c Create) String() string {
+	parts := []string{c.Params.DatabaseType}
+	if c.Params.Version != "" {
+		parts = append(parts, c.Params.Version)
+	}
+	if c.Params.Units != 0 {
+		parts = append(parts, fmt.Sprintf("%d units", c.Params.Units))
+	}
+	if c.Params.Datacenter != "" {
+		parts = append(parts, c.Params.Datacenter)
+	} else {
+		parts = append(parts, "cluster "+c.Params.ClusterID)
+	}
+	return fmt.Sprintf("+ create %s (%s)", c.Params.Name, strings.Join(parts, ", "))
+}
+
+//Apply creates the deployment, returning its provisioning recipe
+func (c Create) Apply(deploymentid string) (*composeapi.Recipe, []error) {
+	deployment, errs := composeapi.CreateDeployment(c.Params)
+	if errs != nil {
+		return nil, errs
+	}
+	if deployment.Errors.Error != "" {
+		return nil, []error{fmt.Errorf("%s", deployment.Errors.Error)}
+	}
+	return &composeapi.Recipe{ID: deployment.ProvisionRecipeID, DeploymentID: deployment.ID}, nil
+}
+
+//Scale changes the units allocated to a deployment
+type Scale struct {
+	Name string
+	ID   string
+	From int
+	To   int
+}
+
+//Deployment returns the deployment name
+func (c Scale) Deployment() string { return c.Name }
+
+//DeploymentID returns the deployment ID
+func (c Scale) DeploymentID() string { return c.ID }
+
+//Symbol returns ~
+func (c Scale) Symbol() string { return "~" }
+
+func (c Scale) String() string {
+	return fmt.Sprintf("~ scale %s from %d to %d units", c.Name, c.From, c.To)
+}
+
+//Apply starts scaling the deployment
+func (c Scale) Apply(deploymentid string) (*composeapi.Recipe, []error) {
+	return composeapi.SetScalingsForDeployment(deploymentid, composeapi.ScalingsParams{Units: c.To})
+}
+
+//Upgrade changes the version of a deployment
+type Upgrade struct {
+	Name string
+	ID   string
+	From string
+	To   string
+}
+
+//Deployment returns the deployment name
+func (c Upgrade) Deployment() string { return c.Name }
+
+//DeploymentID returns the deployment ID
+func (c Upgrade) DeploymentID() string { return c.ID }
+
+//Symbol returns ~
+func (c Upgrade) Symbol() string { return "~" }
+
+func (c Upgrade) String() string {
+	return fmt.Sprintf("~ upgrade %s from %s to %s", c.Name, c.From, c.To)
+}
+
+//Apply starts upgrading the deployment
+func (c Upgrade) Apply(deploymentid string) (*composeapi.Recipe, []error) {
+	return composeapi.UpdateVersionForDeployment(deploymentid, composeapi.UpdateVersionParams{Version: c.To})
+}
+
+//WhitelistAdd allows an address range to connect to a deployment
+type WhitelistAdd struct {
+	Name  string
+	ID    string
+	Entry composeapi.WhitelistParams
+}
+
+//Deployment returns the deployment name
+func (c WhitelistAdd) Deployment() string { return c.Name }
+
+//DeploymentID returns the deployment ID
+func (c WhitelistAdd) DeploymentID() string { return c.ID }
+
+//Symbol returns +
+func (c WhitelistAdd) Symbol() string { return "+" }
+
+func (c WhitelistAdd) String() string {
+	return fmt.Sprintf("+ whitelist %s %s", c.Name, c.Entry.IP)
+}
+
+//Apply starts adding the whitelist entry
+func (c WhitelistAdd) Apply(deploymentid string) (*composeapi.Recipe, []error) {
+	return composeapi.AddWhitelistForDeployment(deploymentid, c.Entry)
+}
+
+//WhitelistRemove stops an address range connecting to a deployment
+type WhitelistRemove struct {
+	Name  string
+	ID    string
+	Entry composeapi.WhitelistEntry
+}
+
+//Deployment returns the deployment name
+func (c WhitelistRemove) Deployment() string { return c.Name }
+
+//DeploymentID returns the deployment ID
+func (c WhitelistRemove) DeploymentID() string { return c.ID }
+
+//Symbol returns -
+func (c WhitelistRemove) Symbol() string { return "-" }
+
+func (c WhitelistRemove) String() string {
+	return fmt.Sprintf("- whitelist %s %s", c.Name, c.Entry.IP)
+}
+
+//Apply starts removing the whitelist entry
+func (c WhitelistRemove) Apply(deploymentid string) (*composeapi.Recipe, []error) {
+	return composeapi.DeleteWhitelistForDeployment(deploymentid, c.Entry.ID)
+}
+
+//TeamAdd gives a team a role on a deployment
+type TeamAdd struct {
+	Name string
+	ID   string
+	Team composeapi.Team
+	Role string
+}
+
+//Deployment returns the deployment name
+func (c TeamAdd) Deployment() string { return c.Name }
+
+//DeploymentID returns the deployment ID
+func (c TeamAdd) DeploymentID() string { return c.ID }
+
+//Symbol returns +
+func (c TeamAdd) Symbol() string { return "+" }
+
+func (c TeamAdd) String() string {
+	return fmt.Sprintf("+ team %s %s as %s", c.Name, c.Team.Name, c.Role)
+}
+
+//Apply adds the team role, which takes effect without a recipe
+func (c TeamAdd) Apply(deploymentid string) (*composeapi.Recipe, []error) {
+	_, errs := composeapi.AddTeamRoleForDeployment(deploymentid,
+		composeapi.TeamRoleParams{Name: c.Role, TeamID: c.Team.ID})
+	if errs != nil {
+		return nil, errs
+	}
+	return &composeapi.Recipe{}, nil
+}
+
+//Deprovision removes a deployment and its data
+type Deprovision struct {
+	Name string
+	ID   string
+}
+
+//Deployment returns the deployment name
+func (c Deprovision) Deployment() string { return c.Name }
+
+//DeploymentID returns the deployment ID
+func (c Deprovision) DeploymentID() string { return c.ID }
+
+//Symbol returns -
+func (c Deprovision) Symbol() string { return "-" }
+
+func (c Deprovision) String() string {
+	return fmt.Sprintf("- deprovision %s", c.Name)
+}
+
+//Apply starts deprovisioning the deployment
+func (c Deprovision) Apply(deploymentid string) (*composeapi.Recipe, []error) {
+	return composeapi.DeprovisionDeployment(deploymentid)
+}
+
+//Summarize counts changes the way a plan is summarized: additions, changes
+//and removals
+func Summarize(changes []Change) (add int, change int, remove int) {
+	for _, v := range changes {
+		switch v.Symbol() {
+		case "+":
+			add++
+		case "~":
+			change++
+		case "-":
+			remove++
+		}
+	}
+	return add, change, remove
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+// Kinds of drift
+const (
+	DriftMissing          = "missing"
+	DriftType             = "type"
+	DriftVersion          = "version"
+	DriftUnits            = "units"
+	DriftWhitelistMissing = "whitelist-missing"
+	DriftWhitelistExtra   = "whitelist-extra"
+	DriftTeamMissing      = "team-missing"
+)
+
+//Drift is one difference between a manifest and live state
+type Drift struct {
+	Deployment string `json:"deployment"`
+	Kind       string `json:"kind"`
+	Declared   string `json:"declared,omitempty"`
+	Live       string `json:"live,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+//FindDrift lists every way states differ from m. Unlike Compute it reports
+//differences which can't be converged, such as versions with no upgrade.
+func FindDrift(m Manifest, states map[string]*State, teams []composeapi.Team) []Drift {
+	found := []Drift{}
+
+	for _, declared := range m.Deployments {
+		state, exists := states[declared.Name]
+		if !exists {
+			found = append(found, Drift{Deployment: declared.Name, Kind: DriftMissing, Declared: declared.Type})
+			continue
+		}
+		if state.Deployment.Type != declared.Type {
+			found = append(found, Drift{Deployment: declared.Name, Kind: DriftType,
+				Declared: declared.Type, Live: state.Deployment.Type})
+			continue
+		}
+
+		if declared.Version != "" && declared.Version != state.Deployment.Version {
+			d := Drift{Deployment: declared.Name, Kind: DriftVersion,
+				Declared: declared.Version, Live: state.Deployment.Version}
+			if HasTransition(state.Versions, declared.Version) {
+				d.Detail = "upgrade available"
+			} else {
+				d.Detail = "no upgrade available"
+			}
+			found = append(found, d)
+		}
+
+		if declared.Units != 0 && declared.Units != state.Scalings.AllocatedUnits {
+			found = append(found, Drift{Deployment: declared.Name, Kind: DriftUnits,
+				Declared: fmt.Sprint(declared.Units), Live: fmt.Sprint(state.Scalings.AllocatedUnits)})
+		}
+
+		declaredips := map[string]bool{}
+		for _, v := range declared.Whitelist {
+			ip := NormalizeCIDR(v.IP)
+			declaredips[ip] = true
+			if !whitelisted(state.Whitelist, ip) {
+				found = append(found, Drift{Deployment: declared.Name, Kind: DriftWhitelistMissing, Declared: ip})
+			}
+		}
+		for _, v := range state.Whitelist {
+			if !declaredips[NormalizeCIDR(v.IP)] {
+				found = append(found, Drift{Deployment: declared.Name, Kind: DriftWhitelistExtra,
+					Live: v.IP, Detail: v.Description})
+			}
+		}
+
+		for _, v := range declared.Teams {
+			team, ok := findTeam(teams, v.Team)
+			if !ok {
+				found = append(found, Drift{Deployment: declared.Name, Kind: DriftTeamMissing,
+					Declared: v.Team + " as " + v.Role, Detail: "no such team"})
+				continue
+			}
+			if !hasTeamRole(state.TeamRoles, team.ID, v.Role) {
+				found = append(found, Drift{Deployment: declared.Name, Kind: DriftTeamMissing,
+					Declared: team.Name + " as " + v.Role})
+			}
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+//Executor runs changes against the API
+type Executor struct {
+	//Parallelism is how many deployments are changed at once. Below one
+	//means one.
+	Parallelism int
+	//Timeout is how long to wait for each recipe
+	Timeout time.Duration
+	//Started, if set, is called as each change starts
+	Started func(change Change)
+	//Finished, if set, is called as each change finishes, with its recipe
+	//once complete
+	Finished func(change Change, recipe *composeapi.Recipe, errs []error)
+}
+
+//Execute makes changes. A deployment runs one recipe at a time, so changes to
+//one deployment are made in order, each waiting for the last one's recipe,
+//and changes to a deployment being created wait for it to provision.
+//Different deployments are changed in parallel. Once a change fails the rest
+//of that deployment's changes are abandoned. Started and Finished may be
+//called from several goroutines at once.
+func (e Executor) Execute(changes []Change) []error {
+	var order []string
+	groups := map[string][]Change{}
+	for _, v := range changes {
+		if _, ok := groups[v.Deployment()]; !ok {
+			order = append(order, v.Deployment())
+		}
+		groups[v.Deployment()] = append(groups[v.Deployment()], v)
+	}
+
+	parallelism := e.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	slots := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var errs []error
+
+	for _, name := range order {
+		wg.Add(1)
+		go func(group []Change) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if grouperrs := e.executeGroup(group); grouperrs != nil {
+				mutex.Lock()
+				errs = append(errs, grouperrs...)
+				mutex.Unlock()
+			}
+		}(groups[name])
+	}
+	wg.Wait()
+
+	return errs
+}
+
+func (e Executor) executeGroup(group []Change) []error {
+	created := ""
+
+	for _, v := range group {
+		deploymentid := v.DeploymentID()
+		if deploymentid == "" {
+			deploymentid = created
+		}
+		if _, ok := v.(Create); !ok && deploymentid == "" {
+			return []error{fmt.Errorf("%s: deployment was not created", v.Deployment())}
+		}
+
+		if e.Started != nil {
+			e.Started(v)
+		}
+
+		recipe, errs := e.executeChange(v, deploymentid)
+
+		if e.Finished != nil {
+			e.Finished(v, recipe, errs)
+		}
+		// In DryRun mode nothing is created, so only changes to a deployment
+		// which already exists can go on to be reported
+		if composeapi.IsDryRun(errs) {
+			if _, ok := v.(Create); ok {
+				return nil
+			}
+			continue
+		}
+		if errs != nil {
+			return prefixErrors(v.Deployment(), errs)
+		}
+
+		if _, ok := v.(Create); ok {
+			created = recipe.DeploymentID
+		}
+	}
+
+	return nil
+}
+
+// executeChange applies c and waits for its recipe to complete
+func (e Executor) executeChange(c Change, deploymentid string) (*composeapi.Recipe, []error) {
+	started, errs := c.Apply(deploymentid)
+	if errs != nil {
+		return nil, errs
+	}
+	if started.ID == "" {
+		return started, nil
+	}
+
+	recipe, errs := composeapi.WaitForRecipe(started.ID, e.Timeout)
+	if errs != nil {
+		return nil, errs
+	}
+	if recipe.Status != composeapi.RecipeStatusComplete {
+		return recipe, []error{fmt.Errorf("recipe %s %s: %s", recipe.ID, recipe.Status, recipe.StatusDetail)}
+	}
+	if recipe.DeploymentID == "" {
+		recipe.DeploymentID = started.DeploymentID
+	}
+
+	return recipe, nil
+}
+
+func prefixErrors(prefix string, errs []error) []error {
+	prefixed := make([]error, len(errs))
+	for i, v := range errs {
+		prefixed[i] = fmt.Errorf("%s: %s", prefix, v)
+	}
+	return prefixed
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plan converges Compose deployments with a declared manifest. It
+// compares the manifest with what the API reports, works out the changes
+// needed and runs them, without keeping any state of its own.
+package plan
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+//Manifest declares the deployments which should exist
+type Manifest struct {
+	Deployments []Deployment `json:"deployments" yaml:"deployments"`
+}
+
+//Deployment declares one deployment. Datacenter, cluster, SSL and WiredTiger
+//only apply when the deployment is created.
+type Deployment struct {
+	Name       string           `json:"name" yaml:"name"`
+	Type       string           `json:"type" yaml:"type"`
+	Version    string           `json:"version,omitempty" yaml:"version,omitempty"`
+	Units      int              `json:"units,omitempty" yaml:"units,omitempty"`
+	Datacenter string           `json:"datacenter,omitempty" yaml:"datacenter,omitempty"`
+	ClusterID  string           `json:"cluster_id,omitempty" yaml:"cluster_id,omitempty"`
+	SSL        bool             `json:"ssl,omitempty" yaml:"ssl,omitempty"`
+	WiredTiger bool             `json:"wiredtiger,omitempty" yaml:"wiredtiger,omitempty"`
+	Whitelist  []WhitelistEntry `json:"whitelist,omitempty" yaml:"whitelist,omitempty"`
+	Teams      []TeamRole       `json:"teams,omitempty" yaml:"teams,omitempty"`
+}
+
+//WhitelistEntry declares an address range allowed to connect
+type WhitelistEntry struct {
+	IP          string `json:"ip" yaml:"ip"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+//TeamRole gives a team, by name or ID, a role on a deployment
+type TeamRole struct {
+	Team string `json:"team" yaml:"team"`
+	Role string `json:"role" yaml:"role"`
+}
+
+//ReadManifest reads a YAML manifest from filename
+func ReadManifest(filename string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return m, nil
+}
+
+//ParseManifest parses a YAML manifest, checking each deployment is named and
+//typed exactly once
+func ParseManifest(data []byte) (*Manifest, error) {
+	m := Manifest{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, v := range m.Deployments {
+		if v.Name == "" || v.Type == "" {
+			return nil, fmt.Errorf("every deployment needs a name and type")
+		}
+		if seen[v.Name] {
+			return nil, fmt.Errorf("deployment %s is declared twice", v.Name)
+		}
+		seen[v.Name] = true
+	}
+
+	return &m, nil
+}
+
+//Names lists the names of the deployments m declares
+func (m Manifest) Names() []string {
+	names := make([]string, len(m.Deployments))
+	for i, v := range m.Deployments {
+		names[i] = v.Name
+	}
+	return names
+}
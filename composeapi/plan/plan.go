@@ -0,0 +1,187 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+//Options control what a plan may do
+type Options struct {
+	//AccountID is the account new deployments are created in
+	AccountID string
+	//PruneWhitelist removes whitelist entries the manifest doesn't list
+	PruneWhitelist bool
+	//Deprovision removes deployments the manifest doesn't list. The states
+	//planned against must then hold every deployment, not only declared ones.
+	Deprovision bool
+}
+
+//Compute works out the changes which take states to m. Changes are returned
+//in the order they should run in for each deployment, along with anything in
+//m which can't be converged.
+func Compute(m Manifest, states map[string]*State, teams []composeapi.Team, opts Options) ([]Change, []error) {
+	var changes []Change
+	var errs []error
+
+	for _, declared := range m.Deployments {
+		state, exists := states[declared.Name]
+
+		if !exists {
+			if declared.Datacenter == "" && declared.ClusterID == "" {
+				errs = append(errs, fmt.Errorf("%s: needs a datacenter or cluster_id to be created", declared.Name))
+				continue
+			}
+			changes = append(changes, Create{Params: composeapi.CreateDeploymentParams{
+				Name:         declared.Name,
+				AccountID:    opts.AccountID,
+				DatabaseType: declared.Type,
+				Datacenter:   declared.Datacenter,
+				ClusterID:    declared.ClusterID,
+				Version:      declared.Version,
+				Units:        declared.Units,
+				SSL:          declared.SSL,
+				WiredTiger:   declared.WiredTiger,
+			}})
+			state = &State{}
+		} else if state.Deployment.Type != declared.Type {
+			errs = append(errs, fmt.Errorf("%s: is %s, not %s", declared.Name, state.Deployment.Type, declared.Type))
+			continue
+		}
+
+		name, id := declared.Name, state.Deployment.ID
+
+		if exists && declared.Version != "" && declared.Version != state.Deployment.Version {
+			if HasTransition(state.Versions, declared.Version) {
+				changes = append(changes, Upgrade{Name: name, ID: id, From: state.Deployment.Version, To: declared.Version})
+			} else {
+				errs = append(errs, fmt.Errorf("%s: no upgrade from %s to %s", name, state.Deployment.Version, declared.Version))
+			}
+		}
+
+		if exists && declared.Units != 0 && declared.Units != state.Scalings.AllocatedUnits {
+			changes = append(changes, Scale{Name: name, ID: id, From: state.Scalings.AllocatedUnits, To: declared.Units})
+		}
+
+		declaredips := map[string]bool{}
+		for _, v := range declared.Whitelist {
+			ip := NormalizeCIDR(v.IP)
+			declaredips[ip] = true
+			if !whitelisted(state.Whitelist, ip) {
+				changes = append(changes, WhitelistAdd{Name: name, ID: id,
+					Entry: composeapi.WhitelistParams{IP: ip, Description: v.Description}})
+			}
+		}
+
+		for _, v := range declared.Teams {
+			team, ok := findTeam(teams, v.Team)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown team %s", name, v.Team))
+				continue
+			}
+			if !hasTeamRole(state.TeamRoles, team.ID, v.Role) {
+				changes = append(changes, TeamAdd{Name: name, ID: id, Team: team, Role: v.Role})
+			}
+		}
+
+		// Removals go last so that nothing is locked out while
+		// replacement entries are added
+		if opts.PruneWhitelist {
+			for _, v := range state.Whitelist {
+				if !declaredips[NormalizeCIDR(v.IP)] {
+					changes = append(changes, WhitelistRemove{Name: name, ID: id, Entry: v})
+				}
+			}
+		}
+	}
+
+	if opts.Deprovision {
+		declared := map[string]bool{}
+		for _, v := range m.Deployments {
+			declared[v.Name] = true
+		}
+		var names []string
+		for k := range states {
+			if !declared[k] {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+		for _, v := range names {
+			changes = append(changes, Deprovision{Name: v, ID: states[v].Deployment.ID})
+		}
+	}
+
+	return changes, errs
+}
+
+//HasTransition reports whether a deployment can be upgraded to version
+func HasTransition(transitions []composeapi.VersionTransition, version string) bool {
+	for _, v := range transitions {
+		if v.ToVersion == version {
+			return true
+		}
+	}
+	return false
+}
+
+//NormalizeCIDR writes single addresses as one address ranges, so that
+//10.0.0.1 and 10.0.0.1/32 compare equal
+func NormalizeCIDR(ip string) string {
+	ip = strings.TrimSpace(ip)
+	if strings.Contains(ip, "/") {
+		return ip
+	}
+	if strings.Contains(ip, ":") {
+		return ip + "/128"
+	}
+	return ip + "/32"
+}
+
+func whitelisted(whitelist []composeapi.WhitelistEntry, ip string) bool {
+	for _, v := range whitelist {
+		if NormalizeCIDR(v.IP) == ip {
+			return true
+		}
+	}
+	return false
+}
+
+func findTeam(teams []composeapi.Team, idorname string) (composeapi.Team, bool) {
+	for _, v := range teams {
+		if v.ID == idorname || v.Name == idorname {
+			return v, true
+		}
+	}
+	return composeapi.Team{}, false
+}
+
+func hasTeamRole(teamroles []composeapi.TeamRole, teamid string, role string) bool {
+	for _, v := range teamroles {
+		if v.Name != role {
+			continue
+		}
+		for _, t := range v.Teams {
+			if t.ID == teamid {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,426 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+	"github.com/compose/cocli/composeapi/composeapitest"
+	"github.com/compose/cocli/composeapi/plan"
+)
+
+var teams = []composeapi.Team{{ID: "team-1", Name: "ops"}}
+
+// liveStates has one PostgreSQL deployment on 9.5.5 with two units, which
+// can be upgraded to 9.6.1, and which ops administers
+func liveStates() map[string]*plan.State {
+	return map[string]*plan.State{
+		"orders": {
+			Deployment: composeapi.Deployment{ID: "deployment-1", Name: "orders", Type: "postgresql", Version: "9.5.5"},
+			Scalings:   composeapi.Scalings{AllocatedUnits: 2},
+			Versions:   []composeapi.VersionTransition{{FromVersion: "9.5.5", ToVersion: "9.6.1"}},
+			Whitelist:  []composeapi.WhitelistEntry{{ID: "whitelist-1", IP: "10.0.0.1/32", Description: "office"}},
+			TeamRoles:  []composeapi.TeamRole{{Name: "admin", Teams: []composeapi.Team{teams[0]}}},
+		},
+	}
+}
+
+// orders declares the deployment liveStates has, changed by change
+func orders(change func(d *plan.Deployment)) plan.Manifest {
+	d := plan.Deployment{
+		Name:      "orders",
+		Type:      "postgresql",
+		Version:   "9.5.5",
+		Units:     2,
+		Whitelist: []plan.WhitelistEntry{{IP: "10.0.0.1", Description: "office"}},
+		Teams:     []plan.TeamRole{{Team: "ops", Role: "admin"}},
+	}
+	if change != nil {
+		change(&d)
+	}
+	return plan.Manifest{Deployments: []plan.Deployment{d}}
+}
+
+func changeStrings(changes []plan.Change) []string {
+	strs := []string{}
+	for _, v := range changes {
+		strs = append(strs, v.String())
+	}
+	return strs
+}
+
+func errorStrings(errs []error) []string {
+	strs := []string{}
+	for _, v := range errs {
+		strs = append(strs, v.Error())
+	}
+	return strs
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest plan.Manifest
+		opts     plan.Options
+		changes  []string
+		errs     []string
+	}{
+		{"no-op", orders(nil), plan.Options{}, []string{}, []string{}},
+		{"unset version and units are left alone", orders(func(d *plan.Deployment) {
+			d.Version, d.Units = "", 0
+		}), plan.Options{}, []string{}, []string{}},
+		{"create", plan.Manifest{Deployments: []plan.Deployment{{
+			Name: "sessions", Type: "redis", Version: "3.2.6", Units: 1, Datacenter: "aws:us-east-1",
+			Whitelist: []plan.WhitelistEntry{{IP: "10.0.0.2"}},
+			Teams:     []plan.TeamRole{{Team: "team-1", Role: "developer"}},
+		}}}, plan.Options{AccountID: "account-1"}, []string{
+			"+ create sessions (redis, 3.2.6, 1 units, aws:us-east-1)",
+			"+ whitelist sessions 10.0.0.2/32",
+			"+ team sessions ops as developer",
+		}, []string{}},
+		{"create needs placement", plan.Manifest{Deployments: []plan.Deployment{{
+			Name: "sessions", Type: "redis",
+		}}}, plan.Options{}, []string{}, []string{"sessions: needs a datacenter or cluster_id to be created"}},
+		{"scale", orders(func(d *plan.Deployment) { d.Units = 4 }), plan.Options{},
+			[]string{"~ scale orders from 2 to 4 units"}, []string{}},
+		{"version", orders(func(d *plan.Deployment) { d.Version = "9.6.1" }), plan.Options{},
+			[]string{"~ upgrade orders from 9.5.5 to 9.6.1"}, []string{}},
+		{"version without upgrade", orders(func(d *plan.Deployment) { d.Version = "9.4.0" }), plan.Options{},
+			[]string{}, []string{"orders: no upgrade from 9.5.5 to 9.4.0"}},
+		{"upgrade before scaling", orders(func(d *plan.Deployment) { d.Version, d.Units = "9.6.1", 3 }), plan.Options{},
+			[]string{"~ upgrade orders from 9.5.5 to 9.6.1", "~ scale orders from 2 to 3 units"}, []string{}},
+		{"type", orders(func(d *plan.Deployment) { d.Type = "mongodb" }), plan.Options{},
+			[]string{}, []string{"orders: is postgresql, not mongodb"}},
+		{"unknown team", orders(func(d *plan.Deployment) { d.Teams = []plan.TeamRole{{Team: "dev", Role: "admin"}} }), plan.Options{},
+			[]string{}, []string{"orders: unknown team dev"}},
+		{"prune adds before removing", orders(func(d *plan.Deployment) {
+			d.Whitelist = []plan.WhitelistEntry{{IP: "10.0.0.9/32"}}
+		}), plan.Options{PruneWhitelist: true}, []string{
+			"+ whitelist orders 10.0.0.9/32",
+			"- whitelist orders 10.0.0.1/32",
+		}, []string{}},
+		{"extra whitelist kept without prune", orders(func(d *plan.Deployment) { d.Whitelist = nil }), plan.Options{},
+			[]string{}, []string{}},
+		{"deprovision", plan.Manifest{}, plan.Options{Deprovision: true},
+			[]string{"- deprovision orders"}, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, errs := plan.Compute(test.manifest, liveStates(), teams, test.opts)
+			if got := changeStrings(changes); !reflect.DeepEqual(got, test.changes) {
+				t.Errorf("changes %q, want %q", got, test.changes)
+			}
+			if got := errorStrings(errs); !reflect.DeepEqual(got, test.errs) {
+				t.Errorf("errors %q, want %q", got, test.errs)
+			}
+		})
+	}
+}
+
+func TestComputeCreateParams(t *testing.T) {
+	m := plan.Manifest{Deployments: []plan.Deployment{{
+		Name: "sessions", Type: "mongodb", ClusterID: "cluster-1", SSL: true, WiredTiger: true,
+	}}}
+
+	changes, errs := plan.Compute(m, nil, teams, plan.Options{AccountID: "account-1"})
+	if errs != nil || len(changes) != 1 {
+		t.Fatalf("changes %q, errors %v", changeStrings(changes), errs)
+	}
+	want := plan.Create{Params: composeapi.CreateDeploymentParams{
+		Name: "sessions", AccountID: "account-1", DatabaseType: "mongodb", ClusterID: "cluster-1", SSL: true, WiredTiger: true,
+	}}
+	if !reflect.DeepEqual(changes[0], want) {
+		t.Errorf("change %+v, want %+v", changes[0], want)
+	}
+}
+
+func TestFindDrift(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest plan.Manifest
+		drift    []plan.Drift
+	}{
+		{"no-op", orders(nil), []plan.Drift{}},
+		{"missing", plan.Manifest{Deployments: []plan.Deployment{{Name: "sessions", Type: "redis"}}}, []plan.Drift{
+			{Deployment: "sessions", Kind: plan.DriftMissing, Declared: "redis"},
+		}},
+		{"type", orders(func(d *plan.Deployment) { d.Type = "mongodb" }), []plan.Drift{
+			{Deployment: "orders", Kind: plan.DriftType, Declared: "mongodb", Live: "postgresql"},
+		}},
+		{"units", orders(func(d *plan.Deployment) { d.Units = 4 }), []plan.Drift{
+			{Deployment: "orders", Kind: plan.DriftUnits, Declared: "4", Live: "2"},
+		}},
+		{"version", orders(func(d *plan.Deployment) { d.Version = "9.6.1" }), []plan.Drift{
+			{Deployment: "orders", Kind: plan.DriftVersion, Declared: "9.6.1", Live: "9.5.5", Detail: "upgrade available"},
+		}},
+		{"version without upgrade", orders(func(d *plan.Deployment) { d.Version = "9.4.0" }), []plan.Drift{
+			{Deployment: "orders", Kind: plan.DriftVersion, Declared: "9.4.0", Live: "9.5.5", Detail: "no upgrade available"},
+		}},
+		{"whitelist", orders(func(d *plan.Deployment) { d.Whitelist = []plan.WhitelistEntry{{IP: "10.0.0.2"}} }), []plan.Drift{
+			{Deployment: "orders", Kind: plan.DriftWhitelistMissing, Declared: "10.0.0.2/32"},
+			{Deployment: "orders", Kind: plan.DriftWhitelistExtra, Live: "10.0.0.1/32", Detail: "office"},
+		}},
+		{"teams", orders(func(d *plan.Deployment) {
+			d.Teams = []plan.TeamRole{{Team: "ops", Role: "developer"}, {Team: "dev", Role: "admin"}}
+		}), []plan.Drift{
+			{Deployment: "orders", Kind: plan.DriftTeamMissing, Declared: "ops as developer"},
+			{Deployment: "orders", Kind: plan.DriftTeamMissing, Declared: "dev as admin", Detail: "no such team"},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := plan.FindDrift(test.manifest, liveStates(), teams); !reflect.DeepEqual(got, test.drift) {
+				t.Errorf("drift %+v, want %+v", got, test.drift)
+			}
+		})
+	}
+}
+
+func TestManifestFromStateRoundTrip(t *testing.T) {
+	states := liveStates()
+	states["sessions"] = &plan.State{
+		Deployment: composeapi.Deployment{ID: "deployment-2", Name: "sessions", Type: "redis", Version: "3.2.6"},
+		Scalings:   composeapi.Scalings{AllocatedUnits: 1},
+		Whitelist:  []composeapi.WhitelistEntry{{ID: "whitelist-2", IP: "fd00::1/128"}},
+	}
+
+	m := plan.ManifestFromState(states)
+	if names := m.Names(); !reflect.DeepEqual(names, []string{"orders", "sessions"}) {
+		t.Errorf("names %q", names)
+	}
+
+	changes, errs := plan.Compute(m, states, teams, plan.Options{PruneWhitelist: true, Deprovision: true})
+	if len(changes) != 0 || len(errs) != 0 {
+		t.Errorf("changes %q, errors %v", changeStrings(changes), errs)
+	}
+	if drift := plan.FindDrift(m, states, teams); len(drift) != 0 {
+		t.Errorf("drift %+v", drift)
+	}
+}
+
+// step is a change which runs apply rather than calling the API
+type step struct {
+	name  string
+	id    string
+	label string
+	apply func(deploymentid string) (*composeapi.Recipe, []error)
+}
+
+func (s step) Deployment() string   { return s.name }
+func (s step) DeploymentID() string { return s.id }
+func (s step) Symbol() string       { return "~" }
+func (s step) String() string       { return s.name + " " + s.label }
+
+func (s step) Apply(deploymentid string) (*composeapi.Recipe, []error) {
+	if s.apply == nil {
+		return &composeapi.Recipe{}, nil
+	}
+	return s.apply(deploymentid)
+}
+
+// recorder keeps the order changes start and finish in
+type recorder struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+// of lists the events for one deployment
+func (r *recorder) of(name string) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	events := []string{}
+	for _, v := range r.events {
+		if strings.Contains(v, " "+name+" ") {
+			events = append(events, v)
+		}
+	}
+	return events
+}
+
+func (r *recorder) executor(parallelism int) plan.Executor {
+	return plan.Executor{
+		Parallelism: parallelism,
+		Timeout:     time.Second,
+		Started:     func(change plan.Change) { r.add("start " + change.String()) },
+		Finished: func(change plan.Change, recipe *composeapi.Recipe, errs []error) {
+			r.add(fmt.Sprintf("finish %s %v", change, errs))
+		},
+	}
+}
+
+func TestExecutorOrder(t *testing.T) {
+	r := &recorder{}
+	errs := r.executor(4).Execute([]plan.Change{
+		step{name: "orders", id: "deployment-1", label: "first"},
+		step{name: "sessions", id: "deployment-2", label: "first"},
+		step{name: "orders", id: "deployment-1", label: "second"},
+		step{name: "orders", id: "deployment-1", label: "third"},
+	})
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	want := []string{
+		"start orders first", "finish orders first []",
+		"start orders second", "finish orders second []",
+		"start orders third", "finish orders third []",
+	}
+	if got := r.of("orders"); !reflect.DeepEqual(got, want) {
+		t.Errorf("events %q, want %q", got, want)
+	}
+}
+
+func TestExecutorParallel(t *testing.T) {
+	// Each deployment's change waits for the other's to start, so they only
+	// both finish if they run at the same time
+	var started sync.WaitGroup
+	started.Add(2)
+	wait := func(string) (*composeapi.Recipe, []error) {
+		started.Done()
+		done := make(chan struct{})
+		go func() { started.Wait(); close(done) }()
+		select {
+		case <-done:
+			return &composeapi.Recipe{}, nil
+		case <-time.After(time.Second):
+			return nil, []error{errors.New("ran alone")}
+		}
+	}
+
+	r := &recorder{}
+	errs := r.executor(2).Execute([]plan.Change{
+		step{name: "orders", id: "deployment-1", apply: wait},
+		step{name: "sessions", id: "deployment-2", apply: wait},
+	})
+	if errs != nil {
+		t.Error(errs)
+	}
+}
+
+func TestExecutorFailureAbandonsGroup(t *testing.T) {
+	fail := func(string) (*composeapi.Recipe, []error) {
+		return nil, []error{errors.New("scaling failed")}
+	}
+
+	r := &recorder{}
+	errs := r.executor(1).Execute([]plan.Change{
+		step{name: "orders", id: "deployment-1", label: "first", apply: fail},
+		step{name: "orders", id: "deployment-1", label: "second"},
+		step{name: "sessions", id: "deployment-2", label: "first"},
+	})
+
+	if got, want := errorStrings(errs), []string{"orders: scaling failed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("errors %q, want %q", got, want)
+	}
+	if got, want := r.of("orders"), []string{"start orders first", "finish orders first [scaling failed]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("orders events %q, want %q", got, want)
+	}
+	if got, want := r.of("sessions"), []string{"start sessions first", "finish sessions first []"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sessions events %q, want %q", got, want)
+	}
+}
+
+func TestExecutorDryRun(t *testing.T) {
+	dryrun := func(string) (*composeapi.Recipe, []error) {
+		return nil, []error{composeapi.ErrDryRun}
+	}
+
+	defer func(dryrun bool) { composeapi.DryRun = dryrun }(composeapi.DryRun)
+	defer func(output io.Writer) { composeapi.DryRunOutput = output }(composeapi.DryRunOutput)
+	composeapi.DryRun, composeapi.DryRunOutput = true, &bytes.Buffer{}
+
+	r := &recorder{}
+	errs := r.executor(1).Execute([]plan.Change{
+		step{name: "orders", id: "deployment-1", label: "first", apply: dryrun},
+		step{name: "orders", id: "deployment-1", label: "second", apply: dryrun},
+		plan.Create{Params: composeapi.CreateDeploymentParams{Name: "sessions", DatabaseType: "redis", Datacenter: "aws:us-east-1"}},
+		step{name: "sessions", label: "scale", apply: dryrun},
+	})
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	// Every change to an existing deployment is reported, but nothing can
+	// follow a create which wasn't sent
+	if got := r.of("orders"); len(got) != 4 {
+		t.Errorf("orders events %q", got)
+	}
+	if got := r.of("sessions"); len(got) != 2 || !strings.HasPrefix(got[0], "start + create sessions") {
+		t.Errorf("sessions events %q", got)
+	}
+}
+
+func TestExecutorWaitsForCreate(t *testing.T) {
+	server := composeapitest.NewServer()
+	defer server.Close()
+	defer server.Install()()
+	server.RecipeStepDuration = time.Millisecond
+
+	defer func(interval time.Duration) { composeapi.RecipePollInterval = interval }(composeapi.RecipePollInterval)
+	composeapi.RecipePollInterval = time.Millisecond
+
+	m := plan.Manifest{Deployments: []plan.Deployment{{
+		Name: "sessions", Type: "redis", Units: 3, Datacenter: "aws:us-east-1",
+		Whitelist: []plan.WhitelistEntry{{IP: "10.0.0.2"}},
+	}}}
+	changes, errs := plan.Compute(m, map[string]*plan.State{}, nil, plan.Options{AccountID: server.Account.ID})
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	var created string
+	executor := plan.Executor{Timeout: time.Second, Finished: func(change plan.Change, recipe *composeapi.Recipe, errs []error) {
+		if _, ok := change.(plan.Create); ok && recipe != nil {
+			created = recipe.DeploymentID
+		}
+	}}
+	if errs := executor.Execute(changes); errs != nil {
+		t.Fatal(errs)
+	}
+
+	states, errs := plan.FetchState(nil)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	state, ok := states["sessions"]
+	if !ok || state.Deployment.ID != created {
+		t.Fatalf("states %+v, created %q", states, created)
+	}
+	if len(state.Whitelist) != 1 || state.Whitelist[0].IP != "10.0.0.2/32" {
+		t.Errorf("whitelist %+v", state.Whitelist)
+	}
+
+	changes, errs = plan.Compute(m, states, nil, plan.Options{})
+	if len(changes) != 0 || errs != nil {
+		t.Errorf("after apply, changes %q, errors %v", changeStrings(changes), errs)
+	}
+}
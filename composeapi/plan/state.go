@@ -0,0 +1,126 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"sort"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+//State is what the API reports about a deployment
+type State struct {
+	Deployment composeapi.Deployment
+	Scalings   composeapi.Scalings
+	Versions   []composeapi.VersionTransition
+	Whitelist  []composeapi.WhitelistEntry
+	TeamRoles  []composeapi.TeamRole
+}
+
+//FetchState gets the state of each named deployment which exists, keyed by
+//name. No names fetches every deployment.
+func FetchState(names []string) (map[string]*State, []error) {
+	deployments, errs := composeapi.GetDeployments()
+	if errs != nil {
+		return nil, errs
+	}
+
+	wanted := map[string]bool{}
+	for _, v := range names {
+		wanted[v] = true
+	}
+
+	states := map[string]*State{}
+	for _, v := range *deployments {
+		if len(names) > 0 && !wanted[v.Name] {
+			continue
+		}
+
+		state := &State{}
+
+		deployment, errs := composeapi.GetDeployment(v.ID)
+		if errs != nil {
+			return nil, errs
+		}
+		state.Deployment = *deployment
+
+		scalings, errs := composeapi.GetScalingsForDeployment(v.ID)
+		if errs != nil {
+			return nil, errs
+		}
+		state.Scalings = *scalings
+
+		versions, errs := composeapi.GetVersionsForDeployment(v.ID)
+		if errs != nil {
+			return nil, errs
+		}
+		state.Versions = *versions
+
+		whitelist, errs := composeapi.GetWhitelistForDeployment(v.ID)
+		if errs != nil {
+			return nil, errs
+		}
+		state.Whitelist = *whitelist
+
+		teamroles, errs := composeapi.GetTeamRolesForDeployment(v.ID)
+		if errs != nil {
+			return nil, errs
+		}
+		state.TeamRoles = *teamroles
+
+		states[v.Name] = state
+	}
+
+	return states, nil
+}
+
+//ManifestFromState declares states exactly, so that planning it against the
+//same states makes no changes. Deployments are sorted by name to keep the
+//manifest stable. The API doesn't report where a deployment was placed or
+//whether it was created with SSL or WiredTiger, so datacenter, cluster_id,
+//ssl and wiredtiger are left out; add them before applying the manifest
+//somewhere the deployments don't yet exist.
+func ManifestFromState(states map[string]*State) Manifest {
+	names := make([]string, 0, len(states))
+	for k := range states {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	m := Manifest{Deployments: []Deployment{}}
+	for _, name := range names {
+		state := states[name]
+		declared := Deployment{
+			Name:    state.Deployment.Name,
+			Type:    state.Deployment.Type,
+			Version: state.Deployment.Version,
+			Units:   state.Scalings.AllocatedUnits,
+		}
+
+		for _, v := range state.Whitelist {
+			declared.Whitelist = append(declared.Whitelist, WhitelistEntry{IP: v.IP, Description: v.Description})
+		}
+
+		for _, role := range state.TeamRoles {
+			for _, team := range role.Teams {
+				declared.Teams = append(declared.Teams, TeamRole{Team: team.Name, Role: role.Name})
+			}
+		}
+
+		m.Deployments = append(m.Deployments, declared)
+	}
+
+	return m
+}
@@ -18,6 +18,17 @@ import (
 	"time"
 )
 
+// Recipe statuses
+const (
+	RecipeStatusWaiting  = "waiting"
+	RecipeStatusRunning  = "running"
+	RecipeStatusComplete = "complete"
+	RecipeStatusFailed   = "failed"
+)
+
+// RecipePollInterval is how often WaitForRecipe checks a recipe's status
+var RecipePollInterval = 5 * time.Second
+
 // Recipe structure
 type Recipe struct {
 	ID           string    `json:"id"`
@@ -0,0 +1,248 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recording records API calls to a directory of fixtures and replays
+// them later in place of the network. Set composeapi.Transport to a Recorder
+// or Replayer to use them.
+//
+// Each call is saved as a numbered JSON file holding the request and
+// response. Secrets are scrubbed with composeapi's redaction rules before
+// anything is written: Authorization headers, secret looking JSON fields,
+// alert channel webhooks and keys, passwords in connection strings, and the
+// query strings of URLs called and of download links, which are pre-signed.
+// Calls are matched on their scrubbed URLs when they are replayed.
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+// unsafe matches runs of characters not wanted in fixture file names
+var unsafe = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+//Interaction is one recorded call
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+//Request is what was sent. Endpoint is the URL relative to
+//composeapi.APIBase, so that calls replay against any base.
+type Request struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Endpoint string      `json:"endpoint"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     string      `json:"body,omitempty"`
+}
+
+//Response is what came back
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+//Recorder is an http.RoundTripper which passes calls on to Transport and
+//saves each one to Dir
+type Recorder struct {
+	Dir string
+	//Transport makes the calls. Nil uses http.DefaultTransport.
+	Transport http.RoundTripper
+
+	mutex sync.Mutex
+	count int
+}
+
+//RoundTrip makes and records a call
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqbody, err := composeapi.ReadBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respbody, err := composeapi.ReadBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	called := composeapi.RedactURL(req.URL.String())
+	interaction := Interaction{
+		Request: Request{
+			Method:   req.Method,
+			URL:      called,
+			Endpoint: endpoint(called),
+			Header:   composeapi.RedactHeader(req.Header),
+			Body:     composeapi.RedactBody(reqbody),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     composeapi.RedactHeader(resp.Header),
+			Body:       composeapi.RedactBody(respbody),
+		},
+	}
+
+	if err := r.save(interaction); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (r *Recorder) save(interaction Interaction) error {
+	data, err := json.MarshalIndent(interaction, "", " ")
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := os.MkdirAll(r.Dir, 0700); err != nil {
+		return err
+	}
+	r.count++
+	name := fmt.Sprintf("%04d-%s-%s.json", r.count, interaction.Request.Method, fixtureName(interaction.Request.URL))
+	return ioutil.WriteFile(filepath.Join(r.Dir, name), append(data, '\n'), 0600)
+}
+
+//Replayer is an http.RoundTripper which answers calls from recorded
+//interactions, never touching the network. Each call is answered by the
+//first unused interaction with the same method and endpoint, so repeated calls,
+//such as polls of a recipe, replay in the order they were recorded.
+type Replayer struct {
+	mutex        sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+//NewReplayer loads the interactions recorded in dir
+func NewReplayer(dir string) (*Replayer, error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(filenames)
+
+	r := &Replayer{}
+	for _, v := range filenames {
+		data, err := ioutil.ReadFile(v)
+		if err != nil {
+			return nil, err
+		}
+		interaction := Interaction{}
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			return nil, fmt.Errorf("%s: %s", v, err)
+		}
+		r.interactions = append(r.interactions, interaction)
+	}
+	r.used = make([]bool, len(r.interactions))
+
+	if len(r.interactions) == 0 {
+		return nil, fmt.Errorf("no recorded calls in %s", dir)
+	}
+	return r, nil
+}
+
+//RoundTrip answers a call from the recording
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	called := endpoint(composeapi.RedactURL(req.URL.String()))
+	for i, v := range r.interactions {
+		if r.used[i] || v.Request.Method != req.Method || v.Request.Endpoint != called {
+			continue
+		}
+		r.used[i] = true
+
+		// Scrubbing may have changed the body's length
+		header := http.Header{}
+		for k, values := range v.Response.Header {
+			if k != "Content-Length" {
+				header[k] = values
+			}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", v.Response.StatusCode, http.StatusText(v.Response.StatusCode)),
+			StatusCode:    v.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(v.Response.Body)),
+			ContentLength: int64(len(v.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no recorded response for %s %s", req.Method, called)
+}
+
+//Unused lists the interactions which haven't been replayed
+func (r *Replayer) Unused() []Interaction {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var unused []Interaction
+	for i, v := range r.interactions {
+		if !r.used[i] {
+			unused = append(unused, v)
+		}
+	}
+	return unused
+}
+
+// endpoint trims composeapi.APIBase from API URLs. Other URLs, such as
+// logfile downloads, are left whole.
+func endpoint(rawurl string) string {
+	return strings.TrimPrefix(rawurl, composeapi.APIBase)
+}
+
+// fixtureName makes an endpoint safe to use in a file name
+func fixtureName(rawurl string) string {
+	name := endpoint(rawurl)
+	if parsed, err := url.Parse(name); err == nil {
+		name = parsed.Path
+	}
+	name = unsafe.ReplaceAllString(strings.Trim(name, "/"), "_")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	return name
+}
@@ -0,0 +1,197 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recording_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/compose/cocli/composeapi"
+	"github.com/compose/cocli/composeapi/composeapitest"
+	"github.com/compose/cocli/composeapi/recording"
+)
+
+// useTransport sets composeapi.Transport for the length of a test
+func useTransport(t *testing.T, transport http.RoundTripper) {
+	previous := composeapi.Transport
+	composeapi.Transport = transport
+	t.Cleanup(func() { composeapi.Transport = previous })
+}
+
+// fixtures reads every fixture recorded in dir
+func fixtures(t *testing.T, dir string) string {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []string
+	for _, v := range filenames {
+		data, err := ioutil.ReadFile(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, string(data))
+	}
+	return strings.Join(all, "\n")
+}
+
+// session makes the calls recorded and replayed, returning what came back
+func session(t *testing.T, deploymentid string) []string {
+	deployments, errs := composeapi.GetDeployments()
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	logfiles, errs := composeapi.GetLogfilesForDeployment(deploymentid)
+	if errs != nil || len(*logfiles) != 1 {
+		t.Fatalf("logfiles %v, errors %v", logfiles, errs)
+	}
+	logfile, errs := composeapi.GetLogfile(deploymentid, (*logfiles)[0].ID)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	content := &bytes.Buffer{}
+	if errs := composeapi.DownloadLogfile(*logfile, content); errs != nil {
+		t.Fatal(errs)
+	}
+	scalings, errs := composeapi.GetScalingsForDeployment(deploymentid)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	return []string{(*deployments)[0].Name, logfile.Name, content.String(), strings.Repeat("unit ", scalings.AllocatedUnits)}
+}
+
+func TestRecordReplay(t *testing.T) {
+	server := composeapitest.NewServer()
+	defer server.Close()
+	t.Cleanup(server.Install())
+	deployment := server.AddDeployment(composeapi.Deployment{Name: "orders", Type: "postgresql"}, 2)
+	server.AddLogfile(deployment.ID, composeapi.Logfile{ID: "logfile-a", Name: "postgresql.log"}, []byte("started\n"))
+
+	dir := t.TempDir()
+	useTransport(t, &recording.Recorder{Dir: dir})
+	recorded := session(t, deployment.ID)
+
+	// Replaying mustn't need the fake
+	server.Close()
+	replayer, err := recording.NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	composeapi.Transport = replayer
+	if replayed := session(t, deployment.ID); !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed %q, recorded %q", replayed, recorded)
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Errorf("unused %+v", unused)
+	}
+
+	if _, errs := composeapi.GetDeployment(deployment.ID); errs == nil || !strings.Contains(errs[0].Error(), "no recorded response for GET deployments/"+deployment.ID) {
+		t.Errorf("unrecorded call gave %v", errs)
+	}
+
+	if all := fixtures(t, dir); strings.Contains(all, server.Token) {
+		t.Errorf("token %q recorded", server.Token)
+	}
+}
+
+func TestReplayerUnused(t *testing.T) {
+	server := composeapitest.NewServer()
+	defer server.Close()
+	t.Cleanup(server.Install())
+	deployment := server.AddDeployment(composeapi.Deployment{Name: "orders", Type: "postgresql"}, 2)
+
+	dir := t.TempDir()
+	useTransport(t, &recording.Recorder{Dir: dir})
+	composeapi.GetDeployments()
+	composeapi.GetScalingsForDeployment(deployment.ID)
+	composeapi.GetScalingsForDeployment(deployment.ID)
+
+	replayer, err := recording.NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	composeapi.Transport = replayer
+	composeapi.GetScalingsForDeployment(deployment.ID)
+
+	var unused []string
+	for _, v := range replayer.Unused() {
+		unused = append(unused, v.Request.Method+" "+v.Request.Endpoint)
+	}
+	want := []string{"GET deployments", "GET deployments/" + deployment.ID + "/scalings"}
+	if !reflect.DeepEqual(unused, want) {
+		t.Errorf("unused %q, want %q", unused, want)
+	}
+}
+
+func TestRecorderScrubs(t *testing.T) {
+	const (
+		token     = "token-abc"
+		password  = "hunter2"
+		signature = "signature-def"
+	)
+	api := composeapi.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"password":"` + password + `",` +
+			`"connection_strings":{"direct":["postgres://admin:` + password + `@orders.example.com:10000/compose"]},` +
+			`"download_link":"https://logs.example.com/postgresql.log?X-Amz-Signature=` + signature + `"}`
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+
+	dir := t.TempDir()
+	recorder := &recording.Recorder{Dir: dir, Transport: api}
+	call := func(transport http.RoundTripper) (*http.Response, error) {
+		req, _ := http.NewRequest("POST", "https://logs.example.com/postgresql.log?X-Amz-Signature="+signature,
+			strings.NewReader(`{"password":"`+password+`"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		return transport.RoundTrip(req)
+	}
+
+	resp, err := call(recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The caller still gets the real response
+	if body, _ := ioutil.ReadAll(resp.Body); !strings.Contains(string(body), signature) {
+		t.Errorf("response body %s", body)
+	}
+
+	all := fixtures(t, dir)
+	for _, secret := range []string{token, password, signature} {
+		if strings.Contains(all, secret) {
+			t.Errorf("%q recorded in %s", secret, all)
+		}
+	}
+	if !strings.Contains(all, "X-Amz-Signature="+composeapi.Redacted) {
+		t.Errorf("query string not kept in %s", all)
+	}
+
+	// Scrubbed calls are still found when they are replayed
+	replayer, err := recording.NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := call(replayer); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//Redacted replaces secrets wherever calls are logged, printed or recorded
+const Redacted = "[REDACTED]"
+
+var (
+	// secretkeys matches JSON fields and headers whose values are secret
+	secretkeys = regexp.MustCompile(`(?i)password|secret|token|key|webhook|authorization|cookie`)
+	// uripassword matches the password in a connection string
+	uripassword = regexp.MustCompile(`(://[^:/@\s"]+):[^@/\s"]+@`)
+)
+
+//IsSecretKey reports whether a JSON field, header or flag named key holds a
+//secret
+func IsSecretKey(key string) bool {
+	return secretkeys.MatchString(key)
+}
+
+//RedactURIPasswords replaces the passwords in any connection strings in s
+func RedactURIPasswords(s string) string {
+	return uripassword.ReplaceAllString(s, "${1}:"+Redacted+"@")
+}
+
+//RedactURL replaces the password and the value of every query parameter in
+//a URL. Download links are pre-signed, carrying their credentials in the
+//query string.
+func RedactURL(rawurl string) string {
+	parsed, err := url.Parse(rawurl)
+	if err != nil || parsed.RawQuery == "" {
+		return RedactURIPasswords(rawurl)
+	}
+
+	keys := []string{}
+	for k := range parsed.Query() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = url.QueryEscape(k) + "=" + Redacted
+	}
+	parsed.RawQuery = strings.Join(keys, "&")
+
+	return RedactURIPasswords(parsed.String())
+}
+
+//RedactParams turns params into plain JSON values with secrets replaced
+func RedactParams(params interface{}) interface{} {
+	if params == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return Redacted
+	}
+	var plain interface{}
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return Redacted
+	}
+
+	return RedactValue(plain)
+}
+
+//RedactValue replaces secrets in a value decoded from JSON, in place. Values
+//of secret fields, the targets of PagerDuty and Slack alert channels, the
+//query strings of download links and passwords in connection strings are
+//all replaced.
+func RedactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			link, islink := inner.(string)
+			switch {
+			case IsSecretKey(key):
+				v[key] = Redacted
+			case key == "download_link" && islink:
+				v[key] = RedactURL(link)
+			default:
+				v[key] = RedactValue(inner)
+			}
+		}
+		// Alert targets for webhook style channels are credentials too
+		if channeltype, ok := v["type"].(string); ok {
+			if channeltype == AlertChannelPagerDuty || channeltype == AlertChannelSlack {
+				if _, ok := v["target"]; ok {
+					v["target"] = Redacted
+				}
+			}
+		}
+		return v
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = RedactValue(inner)
+		}
+		return v
+	case string:
+		return RedactURIPasswords(v)
+	default:
+		return v
+	}
+}
+
+//RedactBody redacts secrets from a JSON body. Other bodies only have
+//connection string passwords redacted.
+func RedactBody(body string) string {
+	var value interface{}
+	if err := json.Unmarshal([]byte(body), &value); err == nil {
+		if data, err := json.Marshal(RedactValue(value)); err == nil {
+			return string(data)
+		}
+	}
+	return RedactURIPasswords(body)
+}
+
+//RedactHeader copies header with credentials redacted
+func RedactHeader(header http.Header) http.Header {
+	redacted := http.Header{}
+	for k, values := range header {
+		switch {
+		case strings.EqualFold(k, "Authorization"):
+			redacted[k] = []string{"Bearer " + Redacted}
+		case IsSecretKey(k):
+			redacted[k] = []string{Redacted}
+		default:
+			redacted[k] = values
+		}
+	}
+	return redacted
+}
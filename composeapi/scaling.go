@@ -0,0 +1,30 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeapi
+
+//Scalings structure
+type Scalings struct {
+	AllocatedUnits int    `json:"allocated_units"`
+	UsedUnits      int    `json:"used_units"`
+	StartingUnits  int    `json:"starting_units"`
+	MinimumUnits   int    `json:"minimum_units"`
+	UnitSizeInMB   int    `json:"unit_size_in_mb"`
+	UnitType       string `json:"unit_type"`
+}
+
+//ScalingsParams Parameters to be completed before scaling a deployment
+type ScalingsParams struct {
+	Units int `json:"units"`
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeapi
+
+//Team structure
+type Team struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+//TeamsResponse structure (an array of Team)
+type TeamsResponse struct {
+	Embedded struct {
+		Teams []Team `json:"teams"`
+	} `json:"_embedded"`
+}
+
+//TeamRole the teams holding a role on a deployment
+type TeamRole struct {
+	Name  string `json:"name"`
+	Teams []Team `json:"teams"`
+}
+
+//TeamRolesResponse structure (an array of TeamRole)
+type TeamRolesResponse struct {
+	Embedded struct {
+		TeamRoles []TeamRole `json:"team_roles"`
+	} `json:"_embedded"`
+}
+
+//TeamRoleParams Parameters to be completed before giving a team a role
+type TeamRoleParams struct {
+	Name   string `json:"name"`
+	TeamID string `json:"team_id"`
+}
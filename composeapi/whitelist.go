@@ -0,0 +1,35 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package composeapi
+
+//WhitelistEntry an IP or range allowed to connect to a deployment
+type WhitelistEntry struct {
+	ID          string `json:"id"`
+	IP          string `json:"ip"`
+	Description string `json:"description"`
+}
+
+//WhitelistResponse structure (an array of WhitelistEntry)
+type WhitelistResponse struct {
+	Embedded struct {
+		Whitelist []WhitelistEntry `json:"whitelist"`
+	} `json:"_embedded"`
+}
+
+//WhitelistParams Parameters to be completed before adding to a whitelist
+type WhitelistParams struct {
+	IP          string `json:"ip"`
+	Description string `json:"description,omitempty"`
+}
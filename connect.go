@@ -0,0 +1,324 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const passwordplaceholder = "[password]"
+
+// cliclients maps deployment types to the client their CLI string runs
+var cliclients = map[string]string{
+	"mongodb":        "mongo",
+	"postgresql":     "psql",
+	"redis":          "redis-cli",
+	"mysql":          "mysql",
+	"rethink":        "rethinkdb",
+	"elastic_search": "curl",
+}
+
+// passwordenvs maps clients to the environment variable they read a
+// password from
+var passwordenvs = map[string]string{
+	"psql":      "PGPASSWORD",
+	"redis-cli": "REDISCLI_AUTH",
+	"mysql":     "MYSQL_PWD",
+}
+
+func connectDeployment() {
+	deployment := getDeployment(*connectdeployment)
+
+	args := splitCommandLine(pickCLIString(deployment.Type, deployment.Connection.CLI))
+	if len(args) == 0 {
+		log.Fatalf("No CLI connection string for deployment %s", deployment.Name)
+	}
+
+	if *connectprintflag {
+		printConnect(deployment.ID, deployment.CACertificateBase64, args)
+		return
+	}
+
+	// Clients which can't read the password from their environment
+	// prompt for it themselves
+	password := ""
+	if _, ok := passwordenvs[filepath.Base(args[0])]; ok {
+		password = os.Getenv(*connectpasswordenv)
+		if password == "" {
+			password = promptPassword(deployment.Name)
+		}
+	}
+	args, env := addPassword(args, nil, password)
+
+	if err := runClient(deployment.CACertificateBase64, args, env); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			log.Printf("%s: %s", args[0], exitErr)
+			os.Exit(1)
+		}
+		log.Fatal(err)
+	}
+}
+
+// runClient runs the client with env added to cocli's own environment,
+// giving it the CA certificate in a temporary file for as long as it runs
+func runClient(cabase64 string, args []string, env []string) error {
+	if cabase64 != "" {
+		cafile, err := writeCACertificate(cabase64)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(cafile)
+		args, env = addCACertificate(args, env, cafile)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// printConnect prints the command which connects, preceded by the
+// environment variables it needs. The password is masked, and the CA
+// certificate is saved somewhere it will stay.
+func printConnect(deploymentid string, cabase64 string, args []string) {
+	var env []string
+	if cabase64 != "" {
+		cafile, err := saveCACertificate(deploymentid, cabase64)
+		if err != nil {
+			log.Fatal(err)
+		}
+		args, env = addCACertificate(args, env, cafile)
+	}
+	args, env = addPassword(args, env, passwordplaceholder)
+
+	var words []string
+	for _, v := range env {
+		parts := strings.SplitN(v, "=", 2)
+		words = append(words, parts[0]+"="+shellQuote(parts[1]))
+	}
+	words = append(words, joinCommandLine(args))
+
+	fmt.Fprintln(stdout, strings.Join(words, " "))
+}
+
+// pickCLIString prefers the CLI string that runs the client for the
+// deployment type, falling back to the first one offered
+func pickCLIString(deploymenttype string, clis []string) string {
+	if len(clis) == 0 {
+		return ""
+	}
+
+	if client, ok := cliclients[deploymenttype]; ok {
+		for _, v := range clis {
+			if strings.HasPrefix(v, client+" ") {
+				return v
+			}
+		}
+	}
+
+	return clis[0]
+}
+
+// writeCACertificate writes a CA certificate to a temporary file, which the
+// caller removes
+func writeCACertificate(cabase64 string) (string, error) {
+	ca, _, err := decodeCACertificate(cabase64)
+	if err != nil {
+		return "", err
+	}
+
+	cafile, err := ioutil.TempFile("", "cocli-ca-")
+	if err != nil {
+		return "", err
+	}
+	defer cafile.Close()
+
+	if _, err := cafile.Write(ca); err != nil {
+		os.Remove(cafile.Name())
+		return "", err
+	}
+
+	return cafile.Name(), nil
+}
+
+// saveCACertificate writes a deployment's CA certificate to
+// ~/.cocli/certs, where it stays for printed commands to use
+func saveCACertificate(deploymentid string, cabase64 string) (string, error) {
+	ca, _, err := decodeCACertificate(cabase64)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(os.TempDir(), "cocli-certs")
+	if home := os.Getenv("HOME"); home != "" {
+		dir = filepath.Join(home, ".cocli", "certs")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	cafile := filepath.Join(dir, deploymentid+".pem")
+	if err := ioutil.WriteFile(cafile, ca, 0644); err != nil {
+		return "", err
+	}
+
+	return cafile, nil
+}
+
+// addCACertificate tells the client to verify the server against cafile
+func addCACertificate(args []string, env []string, cafile string) ([]string, []string) {
+	switch filepath.Base(args[0]) {
+	case "mongo":
+		args = append(args, "--sslCAFile", cafile)
+	case "psql":
+		env = append(env, "PGSSLROOTCERT="+cafile)
+	case "redis-cli":
+		args = append(args, "--tls", "--cacert", cafile)
+	case "mysql":
+		args = append(args, "--ssl-ca="+cafile)
+	case "curl":
+		args = append(args, "--cacert", cafile)
+	}
+
+	return args, env
+}
+
+// addPassword hands password to the client in its environment. The
+// placeholder is taken out of args rather than substituted, as anyone can
+// read a command line with ps; a client with no environment variable for
+// its password is left to prompt for it.
+func addPassword(args []string, env []string, password string) ([]string, []string) {
+	name, ok := passwordenvs[filepath.Base(args[0])]
+
+	var kept []string
+	for _, v := range args {
+		switch {
+		case v == passwordplaceholder:
+			// The flag it belongs to goes too, unless it makes the client
+			// prompt, as mongo -p does
+			if n := len(kept); ok && n > 1 && strings.HasPrefix(kept[n-1], "-") {
+				kept = kept[:n-1]
+			}
+		case strings.HasPrefix(v, "-") && strings.Contains(v, passwordplaceholder):
+			// -p[password] or --password=[password]
+		default:
+			// user:[password]@host, or password=[password] in a
+			// connection string
+			v = strings.Replace(v, ":"+passwordplaceholder, "", -1)
+			v = strings.Replace(v, "password="+passwordplaceholder, "", -1)
+			kept = append(kept, strings.TrimSpace(v))
+		}
+	}
+
+	if ok && password != "" {
+		env = append(env, name+"="+password)
+	}
+
+	return kept, env
+}
+
+// promptPassword reads a password from the terminal with echo turned off
+func promptPassword(name string) string {
+	fmt.Fprintf(os.Stderr, "Password for %s: ", name)
+
+	stty := func(arg string) {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+	stty("-echo")
+	defer stty("echo")
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Fprintln(os.Stderr)
+	if err != nil && password == "" {
+		log.Fatal(err)
+	}
+
+	return strings.TrimRight(password, "\r\n")
+}
+
+// splitCommandLine splits a CLI connection string into arguments, honouring
+// single quotes, double quotes and backslash escapes
+func splitCommandLine(line string) []string {
+	var args []string
+	var current strings.Builder
+	inarg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inarg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inarg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inarg {
+				args = append(args, current.String())
+				current.Reset()
+				inarg = false
+			}
+		default:
+			current.WriteRune(r)
+			inarg = true
+		}
+	}
+	if inarg {
+		args = append(args, current.String())
+	}
+
+	return args
+}
+
+// joinCommandLine quotes args so the result can be pasted into a shell
+func joinCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, v := range args {
+		quoted[i] = shellQuote(v)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote single quotes v if the shell would otherwise interpret it
+func shellQuote(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\n'\"\\$`&|;<>()*?[]{}!#~") {
+		return v
+	}
+
+	return "'" + strings.Replace(v, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,361 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+// setupTracing adds middleware to log calls to stderr and to a HAR file, as
+// --debug and --trace-file ask, returning a function which removes it
+func setupTracing() func() {
+	var middleware []composeapi.Middleware
+	if *debugflag {
+		logger := log.New(os.Stderr, "debug: ", log.LstdFlags)
+		middleware = append(middleware, func(next http.RoundTripper) http.RoundTripper {
+			return &debugTransport{logger: logger, next: next}
+		})
+	}
+	if *tracefile != "" {
+		// Every chain built writes to the same file
+		writer := &harWriter{filename: *tracefile}
+		middleware = append(middleware, func(next http.RoundTripper) http.RoundTripper {
+			return &harTransport{writer: writer, next: next}
+		})
+	}
+	return composeapi.Use(middleware...)
+}
+
+// tracedCall is a call as debug tracing sees it, with secrets redacted. Only
+// JSON and text response bodies are kept; others are only measured.
+type tracedCall struct {
+	Started        time.Time
+	Duration       time.Duration
+	Request        *http.Request
+	URL            string
+	RequestHeader  http.Header
+	RequestBody    string
+	Response       *http.Response
+	ResponseHeader http.Header
+	ResponseBody   string
+	ResponseSize   int64
+	Err            error
+}
+
+// traceCall makes a call through next, passing a redacted copy of it to done
+// once it is complete. JSON and text responses are read whole, but others,
+// such as logfile downloads, stream through to the caller and are complete
+// when their body is closed.
+func traceCall(next http.RoundTripper, req *http.Request, done func(call tracedCall)) (*http.Response, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	call := tracedCall{
+		Started:       time.Now(),
+		Request:       req,
+		URL:           composeapi.RedactURL(req.URL.String()),
+		RequestHeader: composeapi.RedactHeader(req.Header),
+	}
+
+	body, err := composeapi.ReadBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	call.RequestBody = composeapi.RedactBody(body)
+
+	resp, err := next.RoundTrip(req)
+	call.Duration = time.Since(call.Started)
+	if err != nil {
+		call.Err = err
+		done(call)
+		return nil, err
+	}
+
+	call.Response = resp
+	call.ResponseHeader = composeapi.RedactHeader(resp.Header)
+
+	if !isText(resp.Header.Get("Content-Type")) {
+		resp.Body = &measuredBody{ReadCloser: resp.Body, done: func(size int64) {
+			call.ResponseSize = size
+			done(call)
+		}}
+		return resp, nil
+	}
+
+	body, err = composeapi.ReadBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	call.ResponseBody = composeapi.RedactBody(body)
+	call.ResponseSize = int64(len(body))
+	done(call)
+
+	return resp, nil
+}
+
+// isText reports whether a body of contenttype is worth logging
+func isText(contenttype string) bool {
+	mediatype, _, err := mime.ParseMediaType(contenttype)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediatype, "text/") || mediatype == "application/json" ||
+		strings.HasSuffix(mediatype, "+json")
+}
+
+// measuredBody counts the bytes read from a body, reporting them once when it
+// is closed
+type measuredBody struct {
+	io.ReadCloser
+	size int64
+	once sync.Once
+	done func(size int64)
+}
+
+func (b *measuredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	return n, err
+}
+
+func (b *measuredBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.size) })
+	return err
+}
+
+// debugTransport logs every call to logger
+type debugTransport struct {
+	logger *log.Logger
+	next   http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return traceCall(t.next, req, t.log)
+}
+
+func (t *debugTransport) log(call tracedCall) {
+	t.logger.Printf("%s %s", call.Request.Method, call.URL)
+	if call.RequestBody != "" {
+		t.logger.Printf("request body: %s", call.RequestBody)
+	}
+	if call.Err != nil {
+		t.logger.Printf("error after %s: %s", call.Duration, call.Err)
+		return
+	}
+	t.logger.Printf("%s in %s", call.Response.Status, call.Duration)
+	switch {
+	case call.ResponseBody != "":
+		t.logger.Printf("response body: %s", call.ResponseBody)
+	case call.ResponseSize > 0:
+		t.logger.Printf("response body: %d bytes of %s, not shown", call.ResponseSize, call.Response.Header.Get("Content-Type"))
+	}
+}
+
+// harTransport writes every call to a HAR file
+type harTransport struct {
+	writer *harWriter
+	next   http.RoundTripper
+}
+
+func (t *harTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return traceCall(t.next, req, func(call tracedCall) {
+		t.writer.add(newHAREntry(call))
+	})
+}
+
+// harWriter keeps a HAR file of calls. The whole file is rewritten after
+// each call so that it is complete however cocli exits.
+type harWriter struct {
+	mutex    sync.Mutex
+	filename string
+	entries  []harEntry
+}
+
+func (w *harWriter) add(entry harEntry) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.entries = append(w.entries, entry)
+
+	har := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "cocli", Version: "1.0"},
+		Entries: w.entries,
+	}}
+	data, err := json.MarshalIndent(har, "", " ")
+	if err != nil {
+		log.Printf("trace: %s", err)
+		return
+	}
+	if err := ioutil.WriteFile(w.filename, data, 0600); err != nil {
+		log.Printf("trace: %s", err)
+	}
+}
+
+// HAR 1.2, as described at http://www.softwareishard.com/blog/har-12-spec/
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func newHAREntry(call tracedCall) harEntry {
+	req := call.Request
+	milliseconds := float64(call.Duration) / float64(time.Millisecond)
+
+	entry := harEntry{
+		StartedDateTime: call.Started.UTC().Format(time.RFC3339Nano),
+		Time:            milliseconds,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         call.URL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(call.RequestHeader),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(call.RequestBody),
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HTTPVersion: "HTTP/1.1",
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings: harTimings{Wait: milliseconds},
+	}
+
+	if parsed, err := url.Parse(call.URL); err == nil {
+		for k, values := range parsed.Query() {
+			for _, v := range values {
+				entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{k, v})
+			}
+		}
+	}
+	if call.RequestBody != "" {
+		entry.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: call.RequestBody}
+	}
+
+	if call.Err != nil {
+		entry.Comment = call.Err.Error()
+		return entry
+	}
+
+	resp := call.Response
+	entry.Response.Status = resp.StatusCode
+	entry.Response.StatusText = http.StatusText(resp.StatusCode)
+	entry.Response.Headers = harHeaders(call.ResponseHeader)
+	entry.Response.BodySize = int(call.ResponseSize)
+	entry.Response.Content = harContent{
+		Size:     int(call.ResponseSize),
+		MimeType: resp.Header.Get("Content-Type"),
+		Text:     call.ResponseBody,
+	}
+	if call.ResponseBody == "" && call.ResponseSize > 0 {
+		entry.Comment = "response body not recorded"
+	}
+
+	return entry
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for k, values := range header {
+		for _, v := range values {
+			headers = append(headers, harNameValue{k, v})
+		}
+	}
+	return headers
+}
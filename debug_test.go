@@ -0,0 +1,137 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/compose/cocli/composeapi"
+	"github.com/compose/cocli/composeapi/composeapitest"
+)
+
+func TestTraceFile(t *testing.T) {
+	newTestAPI(t)
+	har := filepath.Join(t.TempDir(), "cocli.har")
+
+	runCocli(t, "--trace-file", har, "logs", "orders", "--all", "--dir", t.TempDir())
+
+	data, err := ioutil.ReadFile(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := harFile{}
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatalf("%s: %s", har, err)
+	}
+	if trace.Log.Version != "1.2" {
+		t.Errorf("version %q", trace.Log.Version)
+	}
+
+	var calls []string
+	for _, v := range trace.Log.Entries {
+		path := strings.TrimPrefix(v.Request.URL, composeapi.APIBase)
+		calls = append(calls, v.Request.Method+" "+path)
+
+		authorization := ""
+		for _, header := range v.Request.Headers {
+			if header.Name == "Authorization" {
+				authorization = header.Value
+			}
+		}
+		if authorization != "Bearer "+composeapi.Redacted {
+			t.Errorf("%s sent Authorization %q", path, authorization)
+		}
+
+		if strings.HasPrefix(path, "logfile-downloads/") {
+			// Logfiles stream past tracing, which only measures them
+			if v.Response.Content.Text != "" || v.Response.Content.Size != len("started\n") {
+				t.Errorf("download content %+v", v.Response.Content)
+			}
+		} else if v.Response.Status != http.StatusOK || !strings.HasPrefix(v.Response.Content.Text, "{") {
+			t.Errorf("%s response %+v", path, v.Response)
+		}
+	}
+	want := []string{
+		"GET deployments",
+		"GET deployments/deployment-orders",
+		"GET deployments/deployment-orders/logfiles",
+		"GET deployments/deployment-orders/logfiles/logfile-a",
+		"GET logfile-downloads/deployment-orders/logfile-a",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls\n%s\nwant\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+	if strings.Contains(string(data), composeapitest.Token) {
+		t.Error("token written to trace")
+	}
+}
+
+func TestDebugTransport(t *testing.T) {
+	binary := []byte{0x1f, 0x8b, 0x08, 0x00, 'p', 'a', 's', 's'}
+	api := composeapi.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/logfile" {
+			return &http.Response{StatusCode: http.StatusOK, Status: "200 OK",
+				Header: http.Header{"Content-Type": {"application/gzip"}},
+				Body:   ioutil.NopCloser(bytes.NewReader(binary))}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Status: "200 OK",
+			Header: http.Header{"Content-Type": {"application/hal+json; charset=utf-8"}},
+			Body:   ioutil.NopCloser(strings.NewReader(`{"password":"hunter2"}`))}, nil
+	})
+	logged := &bytes.Buffer{}
+	transport := &debugTransport{logger: log.New(logged, "", 0), next: api}
+
+	get := func(url string) []byte {
+		req, _ := http.NewRequest("GET", url, nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return body
+	}
+
+	if body := get("https://logs.example.com/logfile?Signature=abc"); !bytes.Equal(body, binary) {
+		t.Errorf("logfile body %q", body)
+	}
+	if body := get("https://api.example.com/deployment"); string(body) != `{"password":"hunter2"}` {
+		t.Errorf("deployment body %q", body)
+	}
+
+	want := "GET https://logs.example.com/logfile?Signature=" + composeapi.Redacted + "\n" +
+		"200 OK in "
+	if !strings.HasPrefix(logged.String(), want) {
+		t.Errorf("logged\n%s\nwant prefix\n%s", logged, want)
+	}
+	for _, v := range []string{
+		"response body: 8 bytes of application/gzip, not shown\n",
+		`response body: {"password":"` + composeapi.Redacted + `"}` + "\n",
+	} {
+		if !strings.Contains(logged.String(), v) {
+			t.Errorf("logged\n%s\nwithout %q", logged, v)
+		}
+	}
+	if strings.Contains(logged.String(), "hunter2") || strings.Contains(logged.String(), "abc") || strings.Contains(logged.String(), "\x1f") {
+		t.Errorf("secrets or binary logged\n%s", logged)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+	"github.com/compose/cocli/composeapi/plan"
+)
+
+// driftExitCode is what cocli diff exits with when live state has drifted
+const driftExitCode = 2
+
+// driftReport is the result of comparing a manifest with live state
+type driftReport struct {
+	Manifest    string       `json:"manifest"`
+	Checked     time.Time    `json:"checked"`
+	Deployments int          `json:"deployments"`
+	Drift       []plan.Drift `json:"drift"`
+}
+
+func diffManifest() {
+	m, err := plan.ReadManifest(*difffile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	states, errs := plan.FetchState(m.Names())
+	bailOnErrs(errs)
+	teams, errs := composeapi.GetTeams()
+	bailOnErrs(errs)
+
+	report := driftReport{
+		Manifest:    *difffile,
+		Checked:     time.Now().UTC(),
+		Deployments: len(m.Deployments),
+		Drift:       plan.FindDrift(*m, states, *teams),
+	}
+
+	if *diffjsonflag {
+		printAsJSON(report)
+	} else {
+		printDriftReport(report)
+	}
+
+	if len(report.Drift) > 0 {
+		os.Exit(driftExitCode)
+	}
+}
+
+func printDriftReport(report driftReport) {
+	if len(report.Drift) == 0 {
+		fmt.Fprintf(stdout, "No drift: %d deployments match %s\n", report.Deployments, report.Manifest)
+		return
+	}
+
+	fmt.Fprintf(stdout, "Drift from %s (%d deployments checked at %s):\n\n",
+		report.Manifest, report.Deployments, report.Checked.Format(time.RFC3339))
+	for _, v := range report.Drift {
+		fmt.Fprintf(stdout, "%15s: %s\n", "Deployment", v.Deployment)
+		fmt.Fprintf(stdout, "%15s: %s\n", "Drift", v.Kind)
+		if v.Declared != "" {
+			fmt.Fprintf(stdout, "%15s: %s\n", "Declared", v.Declared)
+		}
+		if v.Live != "" {
+			fmt.Fprintf(stdout, "%15s: %s\n", "Live", v.Live)
+		}
+		if v.Detail != "" {
+			fmt.Fprintf(stdout, "%15s: %s\n", "Detail", v.Detail)
+		}
+		fmt.Fprintln(stdout)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/compose/cocli/composeapi"
+	"gopkg.in/yaml.v2"
+)
+
+const maskedpassword = "****"
+
+// connectionVar is an environment variable describing a deployment
+type connectionVar struct {
+	Name  string
+	Value string
+}
+
+// k8sObjectMeta is the subset of Kubernetes object metadata cocli writes
+type k8sObjectMeta struct {
+	Name        string            `json:"name" yaml:"name"`
+	Namespace   string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+
+	ResourceVersion string `json:"resourceVersion,omitempty" yaml:"-"`
+}
+
+// k8sSecret is a Kubernetes Secret manifest
+type k8sSecret struct {
+	APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string            `json:"kind" yaml:"kind"`
+	Metadata   k8sObjectMeta     `json:"metadata" yaml:"metadata"`
+	Type       string            `json:"type" yaml:"type"`
+	StringData map[string]string `json:"stringData" yaml:"stringData"`
+}
+
+// k8sConfigMap is a Kubernetes ConfigMap manifest
+type k8sConfigMap struct {
+	APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string            `json:"kind" yaml:"kind"`
+	Metadata   k8sObjectMeta     `json:"metadata" yaml:"metadata"`
+	Data       map[string]string `json:"data" yaml:"data"`
+}
+
+// connectionExport is the json format of export connection
+type connectionExport struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Type          string            `json:"type"`
+	URIs          []string          `json:"uris"`
+	CACertificate string            `json:"ca_certificate,omitempty"`
+	Environment   map[string]string `json:"environment"`
+}
+
+func exportConnection() {
+	deployment := getDeployment(*exportconnectiondeployment)
+
+	password, err := readPassword(*exportconnectionpasswordenv, *exportconnectionpasswordfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	uris := connectionURIs(*deployment, *exportconnectionmaskflag, password)
+
+	capem, err := caPEM(*deployment)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	prefix := *exportconnectionprefix
+	if prefix == "" {
+		prefix = envName(deployment.Name)
+	}
+	vars := connectionVars(*deployment, prefix, uris)
+
+	var output []byte
+	switch *exportconnectionformat {
+	case "k8s-secret":
+		output, err = yaml.Marshal(newK8sSecret(*deployment, *exportconnectionname, *exportconnectionnamespace, uris, capem))
+	case "dotenv":
+		output = []byte(formatDotenv(vars, false))
+	case "docker-compose":
+		output, err = yaml.Marshal(newDockerCompose(*exportconnectionservice, vars))
+	case "json":
+		export := connectionExport{
+			ID:            deployment.ID,
+			Name:          deployment.Name,
+			Type:          deployment.Type,
+			URIs:          uris,
+			CACertificate: capem,
+			Environment:   map[string]string{},
+		}
+		for _, v := range vars {
+			export.Environment[v.Name] = v.Value
+		}
+		output, err = json.MarshalIndent(export, "", " ")
+		output = append(output, '\n')
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *exportconnectionoutput == "" {
+		stdout.Write(output)
+		return
+	}
+
+	if err := ioutil.WriteFile(*exportconnectionoutput, output, 0600); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// connectionURIs returns a deployment's direct connection strings, with the
+// password masked or replaced by password when one is given
+func connectionURIs(deployment composeapi.Deployment, mask bool, password string) []string {
+	uris := make([]string, len(deployment.Connection.Direct))
+	for i, v := range deployment.Connection.Direct {
+		switch {
+		case mask:
+			uris[i] = setURIPassword(v, maskedpassword)
+		case password != "":
+			uris[i] = setURIPassword(v, password)
+		default:
+			uris[i] = v
+		}
+	}
+
+	return uris
+}
+
+// caPEM returns a deployment's CA certificate as PEM, or nothing if it has none
+func caPEM(deployment composeapi.Deployment) (string, error) {
+	if deployment.CACertificateBase64 == "" {
+		return "", nil
+	}
+
+	pemdata, _, err := decodeCACertificate(deployment.CACertificateBase64)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pemdata), nil
+}
+
+// connectionVars lists the environment variables for a deployment's
+// connection strings and CA certificate
+func connectionVars(deployment composeapi.Deployment, prefix string, uris []string) []connectionVar {
+	var vars []connectionVar
+
+	for i, v := range uris {
+		if i == 0 {
+			vars = append(vars, connectionVar{prefix + "_URL", v})
+		} else {
+			vars = append(vars, connectionVar{fmt.Sprintf("%s_URL_%d", prefix, i+1), v})
+		}
+	}
+	if deployment.CACertificateBase64 != "" {
+		vars = append(vars, connectionVar{prefix + "_CA_CERTIFICATE_BASE64", deployment.CACertificateBase64})
+	}
+
+	return vars
+}
+
+func formatDotenv(vars []connectionVar, export bool) string {
+	var lines []string
+	for _, v := range vars {
+		if export {
+			lines = append(lines, fmt.Sprintf("export %s=%s", v.Name, shellQuote(v.Value)))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s=%s", v.Name, shellQuote(v.Value)))
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// newK8sSecret builds a Secret holding a deployment's connection URIs and
+// CA certificate
+func newK8sSecret(deployment composeapi.Deployment, name string, namespace string, uris []string, capem string) k8sSecret {
+	secret := k8sSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   newK8sObjectMeta(deployment, name, namespace),
+		Type:       "Opaque",
+		StringData: map[string]string{},
+	}
+
+	for i, v := range uris {
+		if i == 0 {
+			secret.StringData["uri"] = v
+		} else {
+			secret.StringData[fmt.Sprintf("uri-%d", i+1)] = v
+		}
+	}
+	if capem != "" {
+		secret.StringData["ca.pem"] = capem
+	}
+
+	return secret
+}
+
+// newK8sObjectMeta names an object after a deployment unless name is given,
+// and labels it as cocli's
+func newK8sObjectMeta(deployment composeapi.Deployment, name string, namespace string) k8sObjectMeta {
+	if name == "" {
+		name = k8sName(deployment.Name)
+	}
+
+	return k8sObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels: map[string]string{
+			"app.kubernetes.io/managed-by": "cocli",
+		},
+		Annotations: map[string]string{
+			"compose.io/deployment-id":   deployment.ID,
+			"compose.io/deployment-name": deployment.Name,
+			"compose.io/deployment-type": deployment.Type,
+		},
+	}
+}
+
+// newDockerCompose builds a docker-compose fragment which passes vars to
+// service
+func newDockerCompose(service string, vars []connectionVar) yaml.MapSlice {
+	environment := yaml.MapSlice{}
+	for _, v := range vars {
+		environment = append(environment, yaml.MapItem{Key: v.Name, Value: v.Value})
+	}
+
+	return yaml.MapSlice{
+		{Key: "version", Value: "2"},
+		{Key: "services", Value: yaml.MapSlice{
+			{Key: service, Value: yaml.MapSlice{
+				{Key: "environment", Value: environment},
+			}},
+		}},
+	}
+}
+
+// readPassword reads a password from the named environment variable or
+// file, whichever is given
+func readPassword(envname string, filename string) (string, error) {
+	if filename != "" {
+		password, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(password), "\r\n"), nil
+	}
+
+	if envname != "" {
+		return os.Getenv(envname), nil
+	}
+
+	return "", nil
+}
+
+// setURIPassword replaces the password in a connection URI
+func setURIPassword(uri string, password string) string {
+	if strings.Contains(uri, passwordplaceholder) {
+		return strings.Replace(uri, passwordplaceholder, password, -1)
+	}
+
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.User == nil {
+		return uri
+	}
+	if _, ok := parsed.User.Password(); !ok {
+		return uri
+	}
+	parsed.User = url.UserPassword(parsed.User.Username(), password)
+
+	return parsed.String()
+}
+
+// k8sName turns a deployment name into a valid Kubernetes object name
+func k8sName(name string) string {
+	mapped := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, name)
+
+	mapped = strings.Trim(mapped, "-")
+	if len(mapped) > 253 {
+		mapped = mapped[:253]
+	}
+	if mapped == "" {
+		mapped = "compose"
+	}
+
+	return mapped
+}
@@ -0,0 +1,316 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+// latencybuckets are the upper bounds, in seconds, of the API latency histogram
+var latencybuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// deploymentMetrics is what the exporter last saw of a deployment
+type deploymentMetrics struct {
+	ID             string
+	Name           string
+	Type           string
+	AllocatedUnits int
+	UsedUnits      int
+	RunningRecipes int
+	FailedRecipes  int
+	// BackupAge is in seconds, or negative if there are no backups
+	BackupAge float64
+}
+
+// exporterSnapshot is the result of one refresh of deployment state
+type exporterSnapshot struct {
+	Deployments []deploymentMetrics
+	Refreshed   time.Time
+}
+
+type apiCallKey struct {
+	Method   string
+	Endpoint string
+}
+
+type apiCallMetrics struct {
+	Codes       map[int]int
+	Errors      int
+	Buckets     []int
+	DurationSum float64
+	Count       int
+}
+
+// exporter holds the metrics served by cocli exporter
+type exporter struct {
+	mutex         sync.Mutex
+	snapshot      exporterSnapshot
+	refreshErrors int
+	apiCalls      map[apiCallKey]*apiCallMetrics
+}
+
+func runExporter() {
+	e := &exporter{apiCalls: map[apiCallKey]*apiCallMetrics{}}
+	composeapi.AddCallObserver(e.observeCall)
+
+	go func() {
+		for {
+			e.refresh()
+			time.Sleep(*exporterinterval)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", e.serveMetrics)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `<html><head><title>cocli exporter</title></head><body><a href="/metrics">Metrics</a></body></html>`)
+	})
+
+	log.Printf("Serving metrics on %s/metrics", *exporterlisten)
+	log.Fatal(http.ListenAndServe(*exporterlisten, mux))
+}
+
+func (e *exporter) observeCall(call composeapi.Call) {
+	if composeapi.IsDryRun(call.Errors) {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	key := apiCallKey{call.Method, call.Endpoint}
+	metrics, ok := e.apiCalls[key]
+	if !ok {
+		metrics = &apiCallMetrics{Codes: map[int]int{}, Buckets: make([]int, len(latencybuckets))}
+		e.apiCalls[key] = metrics
+	}
+
+	seconds := call.Duration.Seconds()
+	metrics.Codes[call.StatusCode]++
+	metrics.Count++
+	metrics.DurationSum += seconds
+	for i, v := range latencybuckets {
+		if seconds <= v {
+			metrics.Buckets[i]++
+		}
+	}
+	if call.Errors != nil || call.StatusCode >= 400 {
+		metrics.Errors++
+	}
+}
+
+// refresh fetches the state of every deployment. Deployments which can't be
+// fetched are left out until a later refresh succeeds.
+func (e *exporter) refresh() {
+	deployments, errs := composeapi.GetDeployments()
+	if errs != nil {
+		log.Println(errs)
+		e.mutex.Lock()
+		e.refreshErrors++
+		e.mutex.Unlock()
+		return
+	}
+
+	snapshot := exporterSnapshot{Refreshed: time.Now()}
+	failures := 0
+
+	for _, v := range *deployments {
+		metrics := deploymentMetrics{ID: v.ID, Name: v.Name, Type: v.Type, BackupAge: -1}
+
+		scalings, errs := composeapi.GetScalingsForDeployment(v.ID)
+		if errs != nil {
+			log.Printf("%s: %s", v.Name, errs)
+			failures++
+			continue
+		}
+		metrics.AllocatedUnits = scalings.AllocatedUnits
+		metrics.UsedUnits = scalings.UsedUnits
+
+		recipes, errs := composeapi.GetRecipesForDeployment(v.ID)
+		if errs != nil {
+			log.Printf("%s: %s", v.Name, errs)
+			failures++
+			continue
+		}
+		for _, r := range *recipes {
+			switch r.Status {
+			case composeapi.RecipeStatusRunning:
+				metrics.RunningRecipes++
+			case composeapi.RecipeStatusFailed:
+				metrics.FailedRecipes++
+			}
+		}
+
+		backups, errs := composeapi.GetBackupsForDeployment(v.ID)
+		if errs != nil {
+			log.Printf("%s: %s", v.Name, errs)
+			failures++
+			continue
+		}
+		var newest time.Time
+		for _, b := range *backups {
+			if b.Status == "complete" && b.CreatedAt.After(newest) {
+				newest = b.CreatedAt
+			}
+		}
+		if !newest.IsZero() {
+			metrics.BackupAge = snapshot.Refreshed.Sub(newest).Seconds()
+		}
+
+		snapshot.Deployments = append(snapshot.Deployments, metrics)
+	}
+
+	e.mutex.Lock()
+	e.snapshot = snapshot
+	e.refreshErrors += failures
+	e.mutex.Unlock()
+}
+
+func (e *exporter) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.writeMetrics(w)
+}
+
+// writeMetrics writes every metric in the Prometheus text exposition format
+func (e *exporter) writeMetrics(w io.Writer) {
+	deployments := e.snapshot.Deployments
+
+	bytype := map[string]int{}
+	for _, v := range deployments {
+		bytype[v.Type]++
+	}
+	writeMetricHeader(w, "compose_deployments", "gauge", "Number of deployments by type.")
+	for _, t := range sortedKeys(bytype) {
+		writeMetric(w, "compose_deployments", labels("type", t), float64(bytype[t]))
+	}
+
+	perdeployment := []struct {
+		name  string
+		help  string
+		value func(deploymentMetrics) (float64, bool)
+	}{
+		{"compose_deployment_units_allocated", "Units allocated to the deployment.",
+			func(d deploymentMetrics) (float64, bool) { return float64(d.AllocatedUnits), true }},
+		{"compose_deployment_units_used", "Units used by the deployment.",
+			func(d deploymentMetrics) (float64, bool) { return float64(d.UsedUnits), true }},
+		{"compose_deployment_recipes_running", "Recipes running on the deployment.",
+			func(d deploymentMetrics) (float64, bool) { return float64(d.RunningRecipes), true }},
+		{"compose_deployment_recipes_failed", "Recipes which have failed on the deployment.",
+			func(d deploymentMetrics) (float64, bool) { return float64(d.FailedRecipes), true }},
+		{"compose_deployment_backup_age_seconds", "Age of the deployment's newest complete backup.",
+			func(d deploymentMetrics) (float64, bool) { return d.BackupAge, d.BackupAge >= 0 }},
+	}
+	for _, m := range perdeployment {
+		writeMetricHeader(w, m.name, "gauge", m.help)
+		for _, d := range deployments {
+			if value, ok := m.value(d); ok {
+				writeMetric(w, m.name, labels("deployment_id", d.ID, "deployment", d.Name, "type", d.Type), value)
+			}
+		}
+	}
+
+	writeMetricHeader(w, "compose_exporter_last_refresh_timestamp_seconds", "gauge", "When deployment state was last refreshed.")
+	if !e.snapshot.Refreshed.IsZero() {
+		writeMetric(w, "compose_exporter_last_refresh_timestamp_seconds", "", float64(e.snapshot.Refreshed.Unix()))
+	}
+	writeMetricHeader(w, "compose_exporter_refresh_errors_total", "counter", "Failures refreshing deployment state.")
+	writeMetric(w, "compose_exporter_refresh_errors_total", "", float64(e.refreshErrors))
+
+	keys := make([]apiCallKey, 0, len(e.apiCalls))
+	for k := range e.apiCalls {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Endpoint != keys[j].Endpoint {
+			return keys[i].Endpoint < keys[j].Endpoint
+		}
+		return keys[i].Method < keys[j].Method
+	})
+
+	writeMetricHeader(w, "compose_api_requests_total", "counter", "Compose API calls by status code.")
+	for _, k := range keys {
+		codes := e.apiCalls[k].Codes
+		sortedcodes := make([]int, 0, len(codes))
+		for c := range codes {
+			sortedcodes = append(sortedcodes, c)
+		}
+		sort.Ints(sortedcodes)
+		for _, c := range sortedcodes {
+			writeMetric(w, "compose_api_requests_total",
+				labels("method", k.Method, "endpoint", k.Endpoint, "code", strconv.Itoa(c)), float64(codes[c]))
+		}
+	}
+
+	writeMetricHeader(w, "compose_api_errors_total", "counter", "Compose API calls which failed or returned an error status.")
+	for _, k := range keys {
+		writeMetric(w, "compose_api_errors_total", labels("method", k.Method, "endpoint", k.Endpoint), float64(e.apiCalls[k].Errors))
+	}
+
+	writeMetricHeader(w, "compose_api_request_duration_seconds", "histogram", "Compose API call latency.")
+	for _, k := range keys {
+		m := e.apiCalls[k]
+		for i, le := range latencybuckets {
+			writeMetric(w, "compose_api_request_duration_seconds_bucket",
+				labels("method", k.Method, "endpoint", k.Endpoint, "le", strconv.FormatFloat(le, 'g', -1, 64)), float64(m.Buckets[i]))
+		}
+		writeMetric(w, "compose_api_request_duration_seconds_bucket",
+			labels("method", k.Method, "endpoint", k.Endpoint, "le", "+Inf"), float64(m.Count))
+		writeMetric(w, "compose_api_request_duration_seconds_sum", labels("method", k.Method, "endpoint", k.Endpoint), m.DurationSum)
+		writeMetric(w, "compose_api_request_duration_seconds_count", labels("method", k.Method, "endpoint", k.Endpoint), float64(m.Count))
+	}
+}
+
+func writeMetricHeader(w io.Writer, name string, metrictype string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metrictype)
+}
+
+func writeMetric(w io.Writer, name string, labelstr string, value float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labelstr, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// labels formats name, value pairs as a Prometheus label set
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], labelEscaper.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,143 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+	"github.com/compose/cocli/composeapi/composeapitest"
+)
+
+// scrapeMetrics fetches url and returns each sample's value by its name and
+// labels
+func scrapeMetrics(t *testing.T, url string) map[string]float64 {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if contenttype := resp.Header.Get("Content-Type"); contenttype != "text/plain; version=0.0.4" {
+		t.Errorf("Content-Type %q", contenttype)
+	}
+
+	samples := map[string]float64{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		split := strings.LastIndex(line, " ")
+		value, err := strconv.ParseFloat(line[split+1:], 64)
+		if err != nil {
+			t.Fatalf("bad sample %q: %s", line, err)
+		}
+		samples[line[:split]] = value
+	}
+	return samples
+}
+
+func TestExporterMetrics(t *testing.T) {
+	api := composeapitest.NewAPI()
+	orders := api.AddDeployment(composeapi.Deployment{ID: "deployment-orders", Name: "orders", Type: "postgresql"}, 3)
+	api.AddDeployment(composeapi.Deployment{ID: "deployment-broken", Name: "broken", Type: "redis"}, 1)
+	api.AddDeployment(composeapi.Deployment{ID: "deployment-unreachable", Name: "unreachable", Type: "mongodb"}, 1)
+	api.AddBackup(orders.ID, composeapi.Backup{Status: "complete", CreatedAt: time.Now().Add(-time.Hour)})
+
+	// Scalings are slow to answer, one deployment's backups fail, and the
+	// connection drops fetching another's recipes
+	const delay = 60 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/scalings"):
+			time.Sleep(delay)
+		case r.URL.Path == "/deployments/deployment-broken/backups":
+			http.Error(w, `{"errors":{"error":"unavailable"}}`, http.StatusInternalServerError)
+			return
+		case r.URL.Path == "/deployments/deployment-unreachable/recipes":
+			panic(http.ErrAbortHandler)
+		}
+		api.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	base, token := composeapi.APIBase, composeapi.APIToken
+	composeapi.APIBase, composeapi.APIToken = server.URL+"/", api.Token
+	defer func() { composeapi.APIBase, composeapi.APIToken = base, token }()
+
+	e := &exporter{apiCalls: map[apiCallKey]*apiCallMetrics{}}
+	defer composeapi.AddCallObserver(e.observeCall)()
+	e.refresh()
+
+	metrics := httptest.NewServer(http.HandlerFunc(e.serveMetrics))
+	defer metrics.Close()
+	samples := scrapeMetrics(t, metrics.URL+"/metrics")
+
+	counts := map[string]float64{
+		`compose_deployments{type="postgresql"}`: 1,
+		`compose_deployment_units_allocated{deployment_id="deployment-orders",deployment="orders",type="postgresql"}`: 3,
+		`compose_deployment_recipes_running{deployment_id="deployment-orders",deployment="orders",type="postgresql"}`: 0,
+		`compose_deployments{type="redis"}`:                                                                       1,
+		`compose_exporter_refresh_errors_total`:                                                                   1,
+		`compose_api_requests_total{method="GET",endpoint="deployments/:id/recipes",code="0"}`:                    1,
+		`compose_api_errors_total{method="GET",endpoint="deployments/:id/recipes"}`:                               1,
+		`compose_api_requests_total{method="GET",endpoint="deployments",code="200"}`:                              1,
+		`compose_api_requests_total{method="GET",endpoint="deployments/:id/scalings",code="200"}`:                 3,
+		`compose_api_requests_total{method="GET",endpoint="deployments/:id/backups",code="200"}`:                  1,
+		`compose_api_requests_total{method="GET",endpoint="deployments/:id/backups",code="500"}`:                  1,
+		`compose_api_errors_total{method="GET",endpoint="deployments/:id/backups"}`:                               1,
+		`compose_api_errors_total{method="GET",endpoint="deployments/:id/scalings"}`:                              0,
+		`compose_api_request_duration_seconds_bucket{method="GET",endpoint="deployments/:id/scalings",le="0.05"}`: 0,
+		`compose_api_request_duration_seconds_bucket{method="GET",endpoint="deployments/:id/scalings",le="+Inf"}`: 3,
+		`compose_api_request_duration_seconds_count{method="GET",endpoint="deployments/:id/scalings"}`:            3,
+		`compose_api_request_duration_seconds_bucket{method="GET",endpoint="deployments/:id/recipes",le="+Inf"}`:  3,
+	}
+	for sample, want := range counts {
+		if got, ok := samples[sample]; !ok || got != want {
+			t.Errorf("%s = %v, want %v", sample, got, want)
+		}
+	}
+
+	// A deployment which can't be fetched is left out until it can
+	if _, ok := samples[`compose_deployments{type="mongodb"}`]; ok {
+		t.Error("deployment whose refresh failed was exported")
+	}
+
+	// An error status isn't a failed call, so the deployment is still
+	// exported, but with no backup age
+	if _, ok := samples[`compose_deployment_backup_age_seconds{deployment_id="deployment-broken",deployment="broken",type="redis"}`]; ok {
+		t.Error("deployment whose backups failed has a backup age")
+	}
+
+	sum := samples[`compose_api_request_duration_seconds_sum{method="GET",endpoint="deployments/:id/scalings"}`]
+	if sum < 3*delay.Seconds() {
+		t.Errorf("scalings latency sum %vs, want at least %vs", sum, 3*delay.Seconds())
+	}
+	age := samples[`compose_deployment_backup_age_seconds{deployment_id="deployment-orders",deployment="orders",type="postgresql"}`]
+	if age < time.Hour.Seconds() || age > time.Hour.Seconds()+60 {
+		t.Errorf("backup age %vs, want about an hour", age)
+	}
+	if refreshed := samples["compose_exporter_last_refresh_timestamp_seconds"]; time.Since(time.Unix(int64(refreshed), 0)) > time.Minute {
+		t.Errorf("last refresh %v", refreshed)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+	"github.com/compose/cocli/composeapi/composeapitest"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden with the output cocli gives now")
+
+// checkGolden compares output with testdata/name.golden
+func checkGolden(t *testing.T, name string, output string) {
+	t.Helper()
+	filename := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		if err := ioutil.WriteFile(filename, []byte(output), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != string(want) {
+		t.Errorf("output differs from %s (go test -update rewrites it):\n%s", filename, output)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		// modes are the output flags to run the command with, "" for JSON
+		modes []string
+	}{
+		{"show-account", []string{"show", "account"}, []string{"", "--raw", "--fmt"}},
+		{"show-deployments", []string{"show", "deployments"}, []string{"", "--raw", "--fmt"}},
+		{"show-recipe", []string{"show", "recipe", "recipe-2"}, []string{"", "--raw", "--fmt"}},
+		{"show-deployment-recipes", []string{"show", "deployment", "recipes", "deployment-orders"}, []string{"", "--raw", "--fmt"}},
+		{"show-deployment-versions", []string{"show", "deployment", "versions", "deployment-orders"}, []string{"", "--raw", "--fmt"}},
+		{"show-deployment-users", []string{"show", "deployment", "users", "deployment-orders"}, []string{"", "--raw", "--fmt"}},
+		{"show-deployment-scalings", []string{"show", "deployment", "scalings", "deployment-orders"}, []string{"", "--raw", "--fmt"}},
+		{"show-clusters", []string{"show", "clusters"}, []string{"", "--raw", "--fmt"}},
+		{"show-user", []string{"show", "user"}, []string{"", "--raw", "--fmt"}},
+		{"show-alerts", []string{"show", "alerts", "--all"}, []string{"", "--raw", "--fmt"}},
+		{"show-datacenters", []string{"show", "datacenters"}, []string{"", "--raw", "--fmt"}},
+		{"show-databases", []string{"show", "databases"}, []string{"", "--raw", "--fmt"}},
+		{"logs", []string{"logs", "orders"}, []string{"", "--raw", "--fmt"}},
+		{"create-deployment", []string{"create", "deployment", "sessions", "redis", "--datacenter", "aws:us-east-1"}, []string{"", "--fmt"}},
+		{"alerts-set", []string{"alerts", "set", "orders", "--email", "ops@example.com", "--slack", "https://hooks.slack.com/services/T0/B0/x"}, []string{"", "--fmt"}},
+		{"rotate-credentials", []string{"rotate", "credentials", "orders", "--password-env", "COCLI_GOLDEN_PASSWORD"}, []string{""}},
+		{"rotate-credentials-dry-run", []string{"rotate", "credentials", "orders", "--password-env", "COCLI_GOLDEN_PASSWORD", "--dry-run"}, []string{""}},
+		{"export-connection-json", []string{"export", "connection", "orders", "--password-env", "COCLI_GOLDEN_PASSWORD"}, []string{""}},
+		{"export-connection-dotenv", []string{"export", "connection", "orders", "--format", "dotenv", "--mask"}, []string{""}},
+		{"export-connection-k8s-secret", []string{"export", "connection", "orders", "--format", "k8s-secret", "--namespace", "apps"}, []string{""}},
+		{"export-connection-docker-compose", []string{"export", "connection", "orders", "--format", "docker-compose"}, []string{""}},
+		{"export-manifest", []string{"export", "manifest"}, []string{""}},
+		{"env", []string{"env", "orders"}, []string{""}},
+		{"cert", []string{"cert", "orders"}, []string{""}},
+		{"sync-k8s", []string{"sync", "k8s", "--all"}, []string{""}},
+		{"open", []string{"open", "orders", "--print"}, []string{""}},
+		{"connect", []string{"connect", "orders", "--print"}, []string{""}},
+		{"diff", []string{"diff", "-f", filepath.Join("testdata", "manifest.yaml")}, []string{""}},
+		{"apply-dry-run", []string{"apply", "-f", filepath.Join("testdata", "manifest-changed.yaml"), "--dry-run"}, []string{""}},
+	}
+
+	t.Setenv("COCLI_GOLDEN_PASSWORD", "correct-horse-battery")
+	// connect --print saves the CA certificate under $HOME
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, test := range tests {
+		for _, mode := range test.modes {
+			name := test.name
+			args := test.args
+			if mode != "" {
+				name += "." + strings.TrimPrefix(mode, "--")
+				args = append(append([]string{}, args...), mode)
+			}
+
+			t.Run(name, func(t *testing.T) {
+				server := newGoldenAPI(t)
+				// The fake's port and the home directory change from run to run
+				output := strings.NewReplacer(server.URL, "http://composeapitest", home, "$HOME").Replace(runCocli(t, args...))
+				checkGolden(t, name, output)
+			})
+		}
+	}
+}
+
+// newGoldenAPI is a newTestAPI whose clock stands still and whose recipes
+// complete at once, so output is the same every run
+func newGoldenAPI(t *testing.T) *composeapitest.Server {
+	server, deployment := newTestAPI(t)
+	now := time.Date(2016, 7, 5, 9, 30, 0, 0, time.UTC)
+	server.Clock = func() time.Time { return now }
+	server.RecipeStepDuration = 0
+
+	server.AddDeployment(composeapi.Deployment{
+		ID:        "deployment-cache",
+		Name:      "cache",
+		Type:      "redis",
+		CreatedAt: now,
+	}, 1)
+	for _, units := range []int{3, 4} {
+		if _, errs := composeapi.SetScalingsForDeployment(deployment.ID, composeapi.ScalingsParams{Units: units}); errs != nil {
+			t.Fatal(errs)
+		}
+	}
+
+	return server
+}
+
+func TestPrintDeploymentCACertificate(t *testing.T) {
+	tests := []struct {
+		name   string
+		ca     string
+		fullca bool
+	}{
+		{"print-deployment-short-ca", "c2hvcnQ=", false},
+		{"print-deployment-32-char-ca", strings.Repeat("A", 32), false},
+		{"print-deployment-long-ca", strings.Repeat("B", 40), false},
+		{"print-deployment-long-ca-fullca", strings.Repeat("B", 40), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetFlags()
+			*fullcaflag = test.fullca
+
+			output := &bytes.Buffer{}
+			printDeployment(output, composeapi.Deployment{
+				ID:                  "deployment-orders",
+				Name:                "orders",
+				Type:                "postgresql",
+				CreatedAt:           time.Date(2016, 7, 4, 12, 0, 0, 0, time.UTC),
+				CACertificateBase64: test.ca,
+			})
+			checkGolden(t, test.name, output.String())
+		})
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/compose/cocli/composeapi"
+	"gopkg.in/yaml.v2"
+)
+
+// kubeConfig is the subset of a kubeconfig file needed to reach an API server
+type kubeConfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// k8sObject is a manifest sync k8s writes or applies
+type k8sObject struct {
+	// kind and resource name the object as kubectl prints it, and its
+	// collection in the API
+	kind     string
+	resource string
+	metadata *k8sObjectMeta
+	manifest interface{}
+}
+
+// k8sClient talks to the Kubernetes API server selected by a kubeconfig
+type k8sClient struct {
+	server    string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+func syncK8s() {
+	deployments := selectDeployments(*synck8sdeployments, *synck8sallflag)
+
+	password, err := readPassword(*synck8spasswordenv, *synck8spasswordfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var client *k8sClient
+	namespace := *synck8snamespace
+	if *synck8sapplyflag {
+		client, err = newK8sClient(*synck8skubeconfig, *synck8scontext)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if namespace == "" {
+			namespace = client.namespace
+		}
+		if namespace == "" {
+			namespace = "default"
+		}
+	}
+
+	var manifests [][]byte
+	for _, v := range deployments {
+		deployment, errs := composeapi.GetDeployment(v.ID)
+		bailOnErrs(errs)
+
+		capem, err := caPEM(*deployment)
+		if err != nil {
+			log.Fatalf("%s: %s", deployment.Name, err)
+		}
+
+		uris := connectionURIs(*deployment, false, password)
+		secret := newK8sSecret(*deployment, "", namespace, uris, capem)
+		objects := []k8sObject{{"secret", "secrets", &secret.Metadata, &secret}}
+		if *synck8sconfigmapflag {
+			configmap := newK8sConfigMap(*deployment, namespace, capem)
+			objects = append(objects, k8sObject{"configmap", "configmaps", &configmap.Metadata, &configmap})
+		}
+
+		for _, object := range objects {
+			if client != nil {
+				action, err := client.apply(object)
+				if err != nil {
+					log.Fatalf("%s: %s", deployment.Name, err)
+				}
+				fmt.Fprintf(stdout, "%s/%s %s\n", object.kind, object.metadata.Name, action)
+				continue
+			}
+
+			manifest, err := yaml.Marshal(object.manifest)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if *synck8soutputdir != "" {
+				// Secrets keep the deployment's name, as they always have
+				name := object.metadata.Name
+				if object.kind != "secret" {
+					name += "." + object.kind
+				}
+				filename := filepath.Join(*synck8soutputdir, name+".yaml")
+				if err := ioutil.WriteFile(filename, manifest, 0600); err != nil {
+					log.Fatal(err)
+				}
+				fmt.Fprintf(stdout, "%s/%s written to %s\n", object.kind, object.metadata.Name, filename)
+				continue
+			}
+
+			manifests = append(manifests, manifest)
+		}
+	}
+
+	if len(manifests) > 0 {
+		stdout.Write(bytes.Join(manifests, []byte("---\n")))
+	}
+}
+
+// newK8sConfigMap builds a ConfigMap holding what a deployment's clients
+// need to know besides their credentials: where it is and the CA
+// certificate to verify it with
+func newK8sConfigMap(deployment composeapi.Deployment, namespace string, capem string) k8sConfigMap {
+	configmap := k8sConfigMap{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata:   newK8sObjectMeta(deployment, "", namespace),
+		Data: map[string]string{
+			"deployment-id":   deployment.ID,
+			"deployment-name": deployment.Name,
+			"deployment-type": deployment.Type,
+		},
+	}
+
+	// Masked, the passwords' placeholders don't stop the URIs parsing
+	var hosts []string
+	for _, v := range connectionURIs(deployment, true, "") {
+		if parsed, err := url.Parse(v); err == nil && parsed.Host != "" {
+			hosts = append(hosts, parsed.Host)
+		}
+	}
+	if len(hosts) > 0 {
+		configmap.Data["hosts"] = strings.Join(hosts, ",")
+	}
+	if capem != "" {
+		configmap.Data["ca.pem"] = capem
+	}
+
+	return configmap
+}
+
+func newK8sClient(kubeconfigpath string, contextname string) (*k8sClient, error) {
+	if kubeconfigpath == "" {
+		kubeconfigpath = os.Getenv("KUBECONFIG")
+	}
+	if kubeconfigpath == "" {
+		kubeconfigpath = filepath.Join(os.Getenv("HOME"), ".kube", "config")
+	}
+	// Only the first file of a KUBECONFIG list is read
+	kubeconfigpath = filepath.SplitList(kubeconfigpath)[0]
+
+	data, err := ioutil.ReadFile(kubeconfigpath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := kubeConfig{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", kubeconfigpath, err)
+	}
+
+	if contextname == "" {
+		contextname = config.CurrentContext
+	}
+
+	k8s := &k8sClient{}
+	clustername, username := "", ""
+	for _, v := range config.Contexts {
+		if v.Name == contextname {
+			clustername, username = v.Context.Cluster, v.Context.User
+			k8s.namespace = v.Context.Namespace
+		}
+	}
+	if clustername == "" {
+		return nil, fmt.Errorf("context %q not found in %s", contextname, kubeconfigpath)
+	}
+
+	tlsconfig := &tls.Config{}
+	for _, v := range config.Clusters {
+		if v.Name != clustername {
+			continue
+		}
+		k8s.server = strings.TrimRight(v.Cluster.Server, "/")
+		tlsconfig.InsecureSkipVerify = v.Cluster.InsecureSkipTLSVerify
+
+		ca, err := dataOrFile(v.Cluster.CertificateAuthorityData, v.Cluster.CertificateAuthority)
+		if err != nil {
+			return nil, err
+		}
+		if ca != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("no certificates in certificate authority for cluster %s", clustername)
+			}
+			tlsconfig.RootCAs = pool
+		}
+	}
+	if k8s.server == "" {
+		return nil, fmt.Errorf("cluster %q not found in %s", clustername, kubeconfigpath)
+	}
+
+	for _, v := range config.Users {
+		if v.Name != username {
+			continue
+		}
+		k8s.token = v.User.Token
+
+		cert, err := dataOrFile(v.User.ClientCertificateData, v.User.ClientCertificate)
+		if err != nil {
+			return nil, err
+		}
+		key, err := dataOrFile(v.User.ClientKeyData, v.User.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		if cert != nil && key != nil {
+			keypair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, err
+			}
+			tlsconfig.Certificates = []tls.Certificate{keypair}
+		}
+	}
+
+	// Keep the default transport's proxy settings and timeouts
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsconfig
+	k8s.client = &http.Client{Transport: transport}
+
+	return k8s, nil
+}
+
+// dataOrFile returns base64 kubeconfig data, or the contents of the file
+// it names instead
+func dataOrFile(data string, filename string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if filename != "" {
+		return ioutil.ReadFile(filename)
+	}
+	return nil, nil
+}
+
+// apply creates object, or replaces it if it already exists
+func (k8s *k8sClient) apply(object k8sObject) (string, error) {
+	collection := fmt.Sprintf("/api/v1/namespaces/%s/%s", object.metadata.Namespace, object.resource)
+	path := collection + "/" + object.metadata.Name
+
+	status, body, err := k8s.do("GET", path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	switch status {
+	case http.StatusNotFound:
+		status, body, err = k8s.do("POST", collection, object.manifest)
+		if err == nil && status != http.StatusCreated {
+			err = k8sError(status, body)
+		}
+		return "created", err
+	case http.StatusOK:
+		existing := struct {
+			Metadata struct {
+				ResourceVersion string `json:"resourceVersion"`
+			} `json:"metadata"`
+		}{}
+		if err := json.Unmarshal(body, &existing); err != nil {
+			return "", err
+		}
+
+		// Replace the object wholesale, guarded by its resourceVersion
+		object.metadata.ResourceVersion = existing.Metadata.ResourceVersion
+
+		status, body, err = k8s.do("PUT", path, object.manifest)
+		if err == nil && status != http.StatusOK {
+			err = k8sError(status, body)
+		}
+		return "configured", err
+	default:
+		return "", k8sError(status, body)
+	}
+}
+
+// applySecret applies secret
+func (k8s *k8sClient) applySecret(secret k8sSecret) (string, error) {
+	return k8s.apply(k8sObject{"secret", "secrets", &secret.Metadata, &secret})
+}
+
+func (k8s *k8sClient) do(method string, path string, object interface{}) (int, []byte, error) {
+	var reqbody *bytes.Reader
+	if object != nil {
+		payload, err := json.Marshal(object)
+		if err != nil {
+			return 0, nil, err
+		}
+		reqbody = bytes.NewReader(payload)
+	} else {
+		reqbody = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, k8s.server+path, reqbody)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if object != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if k8s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k8s.token)
+	}
+
+	resp, err := k8s.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
+
+// k8sError extracts the message from a Kubernetes Status response
+func k8sError(status int, body []byte) error {
+	kstatus := struct {
+		Message string `json:"message"`
+	}{}
+	if json.Unmarshal(body, &kstatus) == nil && kstatus.Message != "" {
+		return errors.New(kstatus.Message)
+	}
+	return fmt.Errorf("kubernetes API returned %d", status)
+}
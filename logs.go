@@ -0,0 +1,370 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func init() {
+	// --since and --match filter the lines followed, so mean nothing without
+	// --follow
+	logscmd.Validate(func(*kingpin.CmdClause) error {
+		if !*logsfollowflag && (*logssince != 0 || *logsmatch != "") {
+			return errors.New("--since and --match need --follow")
+		}
+		return nil
+	})
+}
+
+func showLogs() {
+	deployment := getDeployment(*logsdeployment)
+
+	if *logsfollowflag {
+		followLogs(*deployment)
+		return
+	}
+
+	if len(*logsdownload) == 0 && !*logsallflag {
+		listLogs(deployment.ID)
+		return
+	}
+
+	var logfiles []composeapi.Logfile
+	if *logsallflag {
+		all, errs := composeapi.GetLogfilesForDeployment(deployment.ID)
+		bailOnErrs(errs)
+		logfiles = *all
+	} else {
+		for _, v := range *logsdownload {
+			logfiles = append(logfiles, composeapi.Logfile{ID: v})
+		}
+	}
+
+	if err := os.MkdirAll(*logsdir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	if errs := downloadLogfiles(deployment.ID, logfiles); errs != nil {
+		log.Fatal(errs)
+	}
+}
+
+func listLogs(deploymentid string) {
+	if *rawmodeflag {
+		text, errs := composeapi.GetLogfilesForDeploymentJSON(deploymentid)
+		bailOnErrs(errs)
+		fmt.Fprintln(stdout, text)
+	} else {
+		logfiles, errs := composeapi.GetLogfilesForDeployment(deploymentid)
+		bailOnErrs(errs)
+		if *formatflag {
+			for _, v := range *logfiles {
+				printLogfile(stdout, v)
+				fmt.Fprintln(stdout)
+			}
+		} else {
+			printAsJSON(*logfiles)
+		}
+	}
+}
+
+// downloadLogfiles fetches logfiles into the logs directory, at most
+// logsconcurrency at a time
+func downloadLogfiles(deploymentid string, logfiles []composeapi.Logfile) []error {
+	var mutex sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+
+	queue := make(chan composeapi.Logfile)
+	workers := *logsconcurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for logfile := range queue {
+				filename, err := downloadLogfile(deploymentid, logfile)
+				mutex.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %s", logfile.ID, err))
+				} else {
+					fmt.Fprintf(stdout, "%s -> %s\n", logfile.ID, filename)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, v := range logfiles {
+		queue <- v
+	}
+	close(queue)
+	wg.Wait()
+
+	return errs
+}
+
+func downloadLogfile(deploymentid string, logfile composeapi.Logfile) (string, error) {
+	// The listing doesn't always carry a download link, so fetch each one
+	full, errs := composeapi.GetLogfile(deploymentid, logfile.ID)
+	if errs != nil {
+		return "", errs[0]
+	}
+
+	// Capsules name their log files alike, so the ID keeps them apart
+	name := full.ID
+	if full.Name != "" {
+		name += "-" + filepath.Base(full.Name)
+	}
+	gunzip := *logsgunzipflag && strings.HasSuffix(name, ".gz")
+	if gunzip {
+		name = strings.TrimSuffix(name, ".gz")
+	}
+	filename := filepath.Join(*logsdir, name)
+
+	// Download to a temporary file, so that a failed download leaves
+	// nothing behind which looks complete
+	file, err := ioutil.TempFile(*logsdir, "."+name+".*.partial")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if gunzip {
+		reader, writer := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			gz, err := gzip.NewReader(reader)
+			if err == nil {
+				_, err = io.Copy(file, gz)
+			}
+			reader.CloseWithError(err)
+			done <- err
+		}()
+
+		errs = composeapi.DownloadLogfile(*full, writer)
+		writer.Close()
+		if err := <-done; err != nil && errs == nil {
+			return "", err
+		}
+	} else {
+		errs = composeapi.DownloadLogfile(*full, file)
+	}
+	if errs != nil {
+		return "", errs[0]
+	}
+
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(file.Name(), filename); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// followLogs polls for log files and prints lines as they are added, until
+// cocli is stopped
+func followLogs(deployment composeapi.Deployment) {
+	var match *regexp.Regexp
+	if *logsmatch != "" {
+		var err error
+		match, err = regexp.Compile(*logsmatch)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var since time.Time
+	if *logssince > 0 {
+		since = time.Now().Add(-*logssince)
+	}
+
+	follower := newLogFollower(deployment, since, match)
+	for {
+		follower.poll()
+		time.Sleep(*logsinterval)
+	}
+}
+
+// logFollower prints the lines added to a deployment's log files. Without a
+// since time, following starts from the end of each capsule's newest file;
+// with one, files dated since then are printed from their start. Files which
+// appear later are printed whole. Only the newest file of each capsule can
+// still be growing, so older files are read up to their end and then left
+// alone.
+type logFollower struct {
+	deployment composeapi.Deployment
+	since      time.Time
+	match      *regexp.Regexp
+	started    bool
+	// offsets are how much of each file has been read
+	offsets map[string]int64
+	// partials are the lines still being written at the end of each file
+	partials map[string]string
+	finished map[string]bool
+}
+
+func newLogFollower(deployment composeapi.Deployment, since time.Time, match *regexp.Regexp) *logFollower {
+	return &logFollower{
+		deployment: deployment,
+		since:      since,
+		match:      match,
+		offsets:    map[string]int64{},
+		partials:   map[string]string{},
+		finished:   map[string]bool{},
+	}
+}
+
+// poll prints the lines added since the last poll
+func (f *logFollower) poll() {
+	logfiles, errs := composeapi.GetLogfilesForDeployment(f.deployment.ID)
+	if errs != nil {
+		log.Println(errs)
+		return
+	}
+	sort.Sort(logfilesByDate(*logfiles))
+
+	newest := map[string]string{}
+	for _, v := range *logfiles {
+		newest[v.CapsuleID] = v.ID
+	}
+
+	for _, v := range *logfiles {
+		if f.finished[v.ID] {
+			continue
+		}
+		complete := newest[v.CapsuleID] != v.ID
+
+		_, seen := f.offsets[v.ID]
+		quiet := false
+		if !seen && !f.started && (f.since.IsZero() || v.Date.Before(f.since)) {
+			// Files from before following started only have their new
+			// lines printed
+			if complete {
+				f.finished[v.ID] = true
+				continue
+			}
+			quiet = true
+		}
+
+		lines, err := f.read(v, complete)
+		if err != nil {
+			log.Printf("%s: %s", v.ID, err)
+			continue
+		}
+		if !quiet {
+			f.print(v, lines)
+		}
+		if complete {
+			f.finished[v.ID] = true
+		}
+	}
+
+	f.started = true
+}
+
+// read downloads what has been added to a log file since it was last read,
+// returning the complete lines added. A line still being written is kept
+// until it's finished, unless the file won't grow any more. Gzipped files
+// don't grow, so are read whole.
+func (f *logFollower) read(logfile composeapi.Logfile, complete bool) ([]string, error) {
+	full, errs := composeapi.GetLogfile(f.deployment.ID, logfile.ID)
+	if errs != nil {
+		return nil, errs[0]
+	}
+
+	var content bytes.Buffer
+	errs = composeapi.DownloadLogfileFrom(*full, f.offsets[logfile.ID], &content)
+	if len(errs) == 1 && errs[0] == composeapi.ErrLogfileShrunk {
+		// The file has been truncated, so start it again
+		f.offsets[logfile.ID], f.partials[logfile.ID] = 0, ""
+		content.Reset()
+		errs = composeapi.DownloadLogfile(*full, &content)
+	}
+	if errs != nil {
+		return nil, errs[0]
+	}
+
+	data := content.Bytes()
+	f.offsets[logfile.ID] += int64(len(data))
+	if f.offsets[logfile.ID] == int64(len(data)) && len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err = ioutil.ReadAll(gz)
+		if err != nil {
+			return nil, err
+		}
+		complete = true
+		f.finished[logfile.ID] = true
+	}
+
+	lines := strings.Split(f.partials[logfile.ID]+string(data), "\n")
+	f.partials[logfile.ID] = lines[len(lines)-1]
+	lines = lines[:len(lines)-1]
+	if complete && f.partials[logfile.ID] != "" {
+		lines = append(lines, f.partials[logfile.ID])
+		f.partials[logfile.ID] = ""
+	}
+	return lines, nil
+}
+
+// print prints the lines which match
+func (f *logFollower) print(logfile composeapi.Logfile, lines []string) {
+	prefix := fmt.Sprintf("[%s/%s]", f.deployment.Name, logfile.CapsuleID)
+	for _, line := range lines {
+		if f.match == nil || f.match.MatchString(line) {
+			fmt.Fprintln(stdout, prefix, line)
+		}
+	}
+}
+
+type logfilesByDate []composeapi.Logfile
+
+func (l logfilesByDate) Len() int           { return len(l) }
+func (l logfilesByDate) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l logfilesByDate) Less(i, j int) bool { return l[i].Date.Before(l[j].Date) }
+
+func printLogfile(w io.Writer, logfile composeapi.Logfile) {
+	fmt.Fprintf(w, "%15s: %s\n", "ID", logfile.ID)
+	fmt.Fprintf(w, "%15s: %s\n", "Name", logfile.Name)
+	fmt.Fprintf(w, "%15s: %s\n", "Capsule ID", logfile.CapsuleID)
+	fmt.Fprintf(w, "%15s: %s\n", "Region", logfile.Region)
+	fmt.Fprintf(w, "%15s: %s\n", "Status", logfile.Status)
+	fmt.Fprintf(w, "%15s: %s\n", "Date", logfile.Date)
+}
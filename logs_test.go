@@ -0,0 +1,187 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+// captureStdout collects what is printed for the length of a test
+func captureStdout(t *testing.T) *bytes.Buffer {
+	output := &bytes.Buffer{}
+	stdout = output
+	t.Cleanup(func() { stdout = os.Stdout })
+	return output
+}
+
+// followed returns what poll prints
+func followed(f *logFollower, output *bytes.Buffer) string {
+	output.Reset()
+	f.poll()
+	return output.String()
+}
+
+func TestFollowLogs(t *testing.T) {
+	server, deployment := newTestAPI(t)
+	output := captureStdout(t)
+
+	var mutex sync.Mutex
+	var ranges []string
+	t.Cleanup(composeapi.Use(func(next http.RoundTripper) http.RoundTripper {
+		return composeapi.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if strings.Contains(req.URL.Path, "logfile-downloads") {
+				mutex.Lock()
+				ranges = append(ranges, req.Header.Get("Range"))
+				mutex.Unlock()
+			}
+			return next.RoundTrip(req)
+		})
+	}))
+
+	f := newLogFollower(deployment, time.Time{}, nil)
+	if got := followed(f, output); got != "" {
+		t.Errorf("first poll printed the history:\n%s", got)
+	}
+
+	server.AppendLogfile(deployment.ID, "logfile-a", []byte("checkpoint\nvacuu"))
+	if got, want := followed(f, output), "[orders/capsule-a] checkpoint\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+	if got := followed(f, output); got != "" {
+		t.Errorf("printed %q with nothing added", got)
+	}
+
+	server.AppendLogfile(deployment.ID, "logfile-a", []byte("m\nshutdown"))
+	if got, want := followed(f, output), "[orders/capsule-a] vacuum\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+
+	// Once a newer file takes over, the last line of the old one is done
+	server.AddLogfile(deployment.ID, composeapi.Logfile{ID: "logfile-b", CapsuleID: "capsule-a"}, []byte("restarted\n"))
+	if got, want := followed(f, output), "[orders/capsule-a] shutdown\n[orders/capsule-a] restarted\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+	followed(f, output)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	want := []string{"", "bytes=8-", "bytes=24-", "bytes=24-", "bytes=34-", "", "bytes=10-"}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("downloaded ranges %q, want %q", ranges, want)
+	}
+}
+
+func TestFollowLogsSince(t *testing.T) {
+	server, deployment := newTestAPI(t)
+	output := captureStdout(t)
+	server.AddLogfile(deployment.ID, composeapi.Logfile{ID: "logfile-b", CapsuleID: "capsule-b", Date: time.Now()}, []byte("recent\n"))
+
+	// logfile-a is from 2016, so only its new lines are printed
+	f := newLogFollower(deployment, time.Now().Add(-time.Hour), nil)
+	if got, want := followed(f, output), "[orders/capsule-b] recent\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+
+	server.AppendLogfile(deployment.ID, "logfile-a", []byte("checkpoint\n"))
+	if got, want := followed(f, output), "[orders/capsule-a] checkpoint\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
+
+func TestFollowLogsMatch(t *testing.T) {
+	server, deployment := newTestAPI(t)
+	output := captureStdout(t)
+
+	f := newLogFollower(deployment, time.Time{}, regexp.MustCompile(`^ERROR`))
+	followed(f, output)
+
+	server.AppendLogfile(deployment.ID, "logfile-a", []byte("LOG ready\nERROR disk full\nLOG ERROR quoted\n"))
+	if got, want := followed(f, output), "[orders/capsule-a] ERROR disk full\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
+
+func TestFollowLogsGzipped(t *testing.T) {
+	server, deployment := newTestAPI(t)
+	output := captureStdout(t)
+
+	f := newLogFollower(deployment, time.Time{}, nil)
+	followed(f, output)
+
+	server.AddLogfile(deployment.ID, composeapi.Logfile{ID: "logfile-b", CapsuleID: "capsule-b"}, gzipped(t, "compressed\n"))
+	if got, want := followed(f, output), "[orders/capsule-b] compressed\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+	if got := followed(f, output); got != "" {
+		t.Errorf("printed %q again", got)
+	}
+}
+
+func gzipped(t *testing.T, content string) []byte {
+	var data bytes.Buffer
+	gz := gzip.NewWriter(&data)
+	if _, err := gz.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return data.Bytes()
+}
+
+func TestDownloadLogfileGunzip(t *testing.T) {
+	server, deployment := newTestAPI(t)
+	dir := t.TempDir()
+	*logsdir, *logsgunzipflag = dir, true
+	t.Cleanup(func() { *logsdir, *logsgunzipflag = ".", false })
+
+	server.AddLogfile(deployment.ID, composeapi.Logfile{ID: "logfile-good", Name: "pg/postgresql.log.gz"}, gzipped(t, "compressed\n"))
+	server.AddLogfile(deployment.ID, composeapi.Logfile{ID: "logfile-bad", Name: "pg/postgresql.log.gz"}, []byte("not gzip"))
+
+	filename, err := downloadLogfile(deployment.ID, composeapi.Logfile{ID: "logfile-good"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filename); string(data) != "compressed\n" || filepath.Base(filename) != "logfile-good-postgresql.log" {
+		t.Errorf("%s holds %q", filename, data)
+	}
+
+	if _, err := downloadLogfile(deployment.ID, composeapi.Logfile{ID: "logfile-bad"}); err == nil {
+		t.Error("downloaded a corrupt gzip file")
+	}
+
+	// The failed download leaves nothing behind
+	entries, _ := ioutil.ReadDir(dir)
+	var names []string
+	for _, v := range entries {
+		names = append(names, v.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"logfile-good-postgresql.log"}) {
+		t.Errorf("directory holds %q", names)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+
+	"github.com/compose/cocli/composeapi/plan"
+	"gopkg.in/yaml.v2"
+)
+
+func exportManifest() {
+	var names []string
+	for _, v := range *exportmanifestdeployments {
+		names = append(names, getDeployment(v).Name)
+	}
+
+	states, errs := plan.FetchState(names)
+	bailOnErrs(errs)
+
+	output, err := yaml.Marshal(plan.ManifestFromState(states))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *exportmanifestoutput == "" {
+		stdout.Write(output)
+		return
+	}
+
+	if err := ioutil.WriteFile(*exportmanifestoutput, output, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+// monitorEvent is the state of one deployment at one poll
+type monitorEvent struct {
+	Time           time.Time `json:"time"`
+	DeploymentID   string    `json:"deployment_id"`
+	Name           string    `json:"name"`
+	Type           string    `json:"type"`
+	AllocatedUnits int       `json:"allocated_units"`
+	UsedUnits      int       `json:"used_units"`
+	RunningRecipes []string  `json:"running_recipes"`
+	StuckRecipes   []string  `json:"stuck_recipes"`
+	Health         string    `json:"health"`
+	Warnings       []string  `json:"warnings"`
+	Errors         []string  `json:"errors,omitempty"`
+}
+
+var healthclient = &http.Client{Timeout: 5 * time.Second}
+
+func monitorDeployments() {
+	deployments := selectDeployments(*monitordeployments, *monitorallflag)
+
+	for {
+		events := make([]monitorEvent, len(deployments))
+		for i, v := range deployments {
+			events[i] = pollDeployment(v)
+		}
+
+		if *monitorjsonflag {
+			encoder := json.NewEncoder(stdout)
+			for _, v := range events {
+				encoder.Encode(v)
+			}
+		} else {
+			printDashboard(events)
+		}
+
+		if *monitoronceflag {
+			return
+		}
+		time.Sleep(*monitorinterval)
+	}
+}
+
+func pollDeployment(listed composeapi.Deployment) monitorEvent {
+	deploymentid := listed.ID
+	event := monitorEvent{
+		Time:           time.Now(),
+		DeploymentID:   deploymentid,
+		Name:           listed.Name,
+		Type:           listed.Type,
+		RunningRecipes: []string{},
+		StuckRecipes:   []string{},
+		Warnings:       []string{},
+	}
+
+	deployment, errs := composeapi.GetDeployment(deploymentid)
+	if errs != nil {
+		event.Errors = errorStrings(errs)
+		return event
+	}
+
+	scalings, errs := composeapi.GetScalingsForDeployment(deploymentid)
+	if errs != nil {
+		event.Errors = append(event.Errors, errorStrings(errs)...)
+	} else {
+		event.AllocatedUnits = scalings.AllocatedUnits
+		event.UsedUnits = scalings.UsedUnits
+		if scalings.AllocatedUnits > 0 &&
+			float64(scalings.UsedUnits) >= *monitorunitthreshold*float64(scalings.AllocatedUnits) {
+			event.Warnings = append(event.Warnings,
+				fmt.Sprintf("using %d of %d units", scalings.UsedUnits, scalings.AllocatedUnits))
+		}
+	}
+
+	recipes, errs := composeapi.GetRecipesForDeployment(deploymentid)
+	if errs != nil {
+		event.Errors = append(event.Errors, errorStrings(errs)...)
+	} else {
+		for _, v := range *recipes {
+			if v.Status != composeapi.RecipeStatusRunning {
+				continue
+			}
+			event.RunningRecipes = append(event.RunningRecipes, v.ID)
+			if !v.CreatedAt.IsZero() && time.Since(v.CreatedAt) > *monitorstuckafter {
+				event.StuckRecipes = append(event.StuckRecipes, v.ID)
+				event.Warnings = append(event.Warnings,
+					fmt.Sprintf("recipe %s (%s) running for %s", v.ID, v.Name, time.Since(v.CreatedAt).Truncate(time.Second)))
+			}
+		}
+	}
+
+	event.Health = checkHealth(deployment.Connection.Health)
+	if event.Health != "ok" && event.Health != "n/a" {
+		event.Warnings = append(event.Warnings, "health "+event.Health)
+	}
+
+	return event
+}
+
+// checkHealth requests a deployment's health endpoint, if it has one which
+// can be reached over HTTP
+func checkHealth(health string) string {
+	parsed, err := url.Parse(health)
+	if health == "" || err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "n/a"
+	}
+
+	resp, err := healthclient.Get(health)
+	if err != nil {
+		return "unreachable"
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return "ok"
+	}
+	return resp.Status
+}
+
+func printDashboard(events []monitorEvent) {
+	// Clear the screen and home the cursor before redrawing
+	fmt.Fprint(stdout, "\033[H\033[2J")
+	fmt.Fprintf(stdout, "cocli monitor - %s (every %s)\n\n", time.Now().Format(time.RFC1123), *monitorinterval)
+	fmt.Fprintf(stdout, "%-24s %-12s %-9s %-8s %-12s %s\n", "NAME", "TYPE", "UNITS", "RECIPES", "HEALTH", "WARNINGS")
+
+	for _, v := range events {
+		units := fmt.Sprintf("%d/%d", v.UsedUnits, v.AllocatedUnits)
+		warnings := strings.Join(append(v.Warnings, v.Errors...), "; ")
+		fmt.Fprintf(stdout, "%-24s %-12s %-9s %-8d %-12s %s\n", v.Name, v.Type, units, len(v.RunningRecipes), v.Health, warnings)
+	}
+}
+
+func errorStrings(errs []error) []string {
+	strs := make([]string, len(errs))
+	for i, v := range errs {
+		strs[i] = v.Error()
+	}
+	return strs
+}
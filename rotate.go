@@ -0,0 +1,150 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+
+	"github.com/compose/cocli/composeapi"
+	"gopkg.in/yaml.v2"
+)
+
+const passwordalphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// minpasswordlength is the shortest password rotate will generate
+const minpasswordlength = 12
+
+func rotateCredentials() {
+	if *rotatepasswordlength < minpasswordlength {
+		log.Fatalf("--password-length must be at least %d", minpasswordlength)
+	}
+
+	deployment := getDeployment(*rotatedeployment)
+
+	password, err := readPassword(*rotatepasswordenv, *rotatepasswordfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	generated := password == ""
+	if generated {
+		password, err = generatePassword(*rotatepasswordlength)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Once the change is sent the API may have applied it, so a generated
+	// password must be shown however rotation ends
+	fail := func(format string, args ...interface{}) {
+		if generated {
+			log.Printf("New password for %s, which may have been applied: %s", *rotateuser, password)
+		}
+		log.Fatalf(format, args...)
+	}
+
+	recipe, errs := composeapi.ChangePasswordForDeploymentUser(deployment.ID, *rotateuser,
+		composeapi.ChangePasswordParams{Password: password})
+	if composeapi.IsDryRun(errs) {
+		return
+	}
+	if errs != nil {
+		fail("%v", errs)
+	}
+	if recipe.ID == "" {
+		fail("Password change for %s was not accepted", *rotateuser)
+	}
+
+	fmt.Fprintf(stdout, "%15s: %s\n", "Recipe ID", recipe.ID)
+	fmt.Fprintf(stdout, "%15s: %s\n", "User", *rotateuser)
+	if generated {
+		fmt.Fprintf(stdout, "%15s: %s\n", "Password", password)
+	}
+
+	// Written before waiting in case the wait fails, and again once the
+	// connection strings are current
+	if err := writeRotated(*deployment, password); err != nil {
+		fail("%s", err)
+	}
+
+	recipe, errs = composeapi.WaitForRecipe(recipe.ID, *rotatetimeout)
+	if errs != nil {
+		fail("%v", errs)
+	}
+	if recipe.Status != composeapi.RecipeStatusComplete {
+		fail("Recipe %s %s: %s", recipe.ID, recipe.Status, recipe.StatusDetail)
+	}
+
+	deployment, errs = composeapi.GetDeployment(deployment.ID)
+	if errs != nil {
+		fail("%v", errs)
+	}
+
+	for _, v := range connectionURIs(*deployment, false, password) {
+		fmt.Fprintf(stdout, "%15s: %s\n", "Direct Connect", v)
+	}
+
+	if err := writeRotated(*deployment, password); err != nil {
+		fail("%s", err)
+	}
+}
+
+// writeRotated writes the connection strings with the new password to the
+// files asked for with --output and --k8s-secret
+func writeRotated(deployment composeapi.Deployment, password string) error {
+	uris := connectionURIs(deployment, false, password)
+
+	if *rotateoutput != "" {
+		vars := connectionVars(deployment, envName(deployment.Name), uris)
+		if err := ioutil.WriteFile(*rotateoutput, []byte(formatDotenv(vars, false)), 0600); err != nil {
+			return err
+		}
+	}
+
+	if *rotatek8ssecret != "" {
+		capem, err := caPEM(deployment)
+		if err != nil {
+			return err
+		}
+		manifest, err := yaml.Marshal(newK8sSecret(deployment, "", *rotatenamespace, uris, capem))
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*rotatek8ssecret, manifest, 0600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generatePassword makes a random alphanumeric password
+func generatePassword(length int) (string, error) {
+	password := make([]byte, length)
+	max := big.NewInt(int64(len(passwordalphabet)))
+
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		password[i] = passwordalphabet[n.Int64()]
+	}
+
+	return string(password), nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+// checkCreateParams makes the checks on params which need no API calls.
+// Unlike validateCreateParams, --no-validate doesn't skip them.
+func checkCreateParams(params composeapi.CreateDeploymentParams) []error {
+	var errs []error
+
+	if params.Name == "" {
+		errs = append(errs, fmt.Errorf("deployment name is required"))
+	}
+
+	switch {
+	case params.Datacenter == "" && params.ClusterID == "":
+		errs = append(errs, fmt.Errorf("must supply either a --cluster id or --datacenter region"))
+	case params.Datacenter != "" && params.ClusterID != "":
+		errs = append(errs, fmt.Errorf("must supply a --cluster id or a --datacenter region, not both"))
+	}
+
+	if params.WiredTiger && params.DatabaseType != "mongodb" {
+		errs = append(errs, fmt.Errorf("--wiredtiger only applies to mongodb deployments"))
+	}
+	if params.CacheMode && params.DatabaseType != "redis" {
+		errs = append(errs, fmt.Errorf("--cache-mode only applies to redis deployments"))
+	}
+	if params.Units < 0 {
+		errs = append(errs, fmt.Errorf("--units must be positive"))
+	}
+
+	return errs
+}
+
+// validateCreateParams checks params against the database types,
+// datacenters and clusters the API offers, before anything is created
+func validateCreateParams(params composeapi.CreateDeploymentParams) []error {
+	var errs []error
+
+	databases, apierrs := composeapi.GetDatabases()
+	if apierrs != nil {
+		return append(errs, apierrs...)
+	}
+	errs = append(errs, validateDatabase(params.DatabaseType, params.Version, *databases)...)
+
+	if params.Datacenter != "" {
+		datacenters, apierrs := composeapi.GetDatacenters()
+		if apierrs != nil {
+			return append(errs, apierrs...)
+		}
+		var slugs []string
+		for _, v := range *datacenters {
+			slugs = append(slugs, v.Slug)
+		}
+		if !contains(slugs, params.Datacenter) {
+			errs = append(errs, unknownError("datacenter", params.Datacenter, slugs))
+		}
+	}
+
+	if params.ClusterID != "" {
+		clusters, apierrs := composeapi.GetClusters()
+		if apierrs != nil {
+			return append(errs, apierrs...)
+		}
+		var ids []string
+		for _, v := range *clusters {
+			ids = append(ids, v.ID)
+		}
+		if !contains(ids, params.ClusterID) {
+			errs = append(errs, unknownError("cluster", params.ClusterID, ids))
+		}
+	}
+
+	return errs
+}
+
+func validateDatabase(databasetype string, version string, databases []composeapi.Database) []error {
+	var types []string
+	for _, database := range databases {
+		types = append(types, database.DatabaseType)
+		if database.DatabaseType != databasetype {
+			continue
+		}
+
+		var versions []string
+		for _, v := range database.Embedded.Versions {
+			if v.Status == "deprecated" {
+				if v.Version == version {
+					return []error{fmt.Errorf("%s version %s is deprecated", databasetype, version)}
+				}
+				continue
+			}
+			versions = append(versions, v.Version)
+		}
+
+		if len(versions) == 0 {
+			return []error{fmt.Errorf("%s has no versions available", databasetype)}
+		}
+		if version != "" && !contains(versions, version) {
+			return []error{unknownError(databasetype+" version", version, versions)}
+		}
+		return nil
+	}
+
+	if databasetype == "" {
+		return []error{fmt.Errorf("deployment type is required (one of %s)", strings.Join(types, ", "))}
+	}
+	return []error{unknownError("deployment type", databasetype, types)}
+}
+
+// unknownError reports value as unknown, suggesting the closest candidate
+func unknownError(what string, value string, candidates []string) error {
+	if suggestion := suggest(value, candidates); suggestion != "" {
+		return fmt.Errorf("unknown %s %q, did you mean %q?", what, value, suggestion)
+	}
+	return fmt.Errorf("unknown %s %q (one of %s)", what, value, strings.Join(candidates, ", "))
+}
+
+// suggest returns the candidate closest to value, if any is close enough to
+// be a likely typo
+func suggest(value string, candidates []string) string {
+	best := ""
+	bestdistance := len(value)/2 + 2
+
+	for _, v := range candidates {
+		distance := levenshtein(strings.ToLower(value), strings.ToLower(v))
+		if distance < bestdistance {
+			best, bestdistance = v, distance
+		}
+	}
+
+	return best
+}
+
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+func min3(a int, b int, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 Compose, an IBM Company
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/compose/cocli/composeapi"
+)
+
+// database offers databasetype at versions, each "version" or
+// "version:status"
+func database(databasetype string, versions ...string) composeapi.Database {
+	d := composeapi.Database{DatabaseType: databasetype, Status: "running"}
+	for _, v := range versions {
+		version := composeapi.Version{Application: databasetype, Version: v, Status: "running"}
+		if parts := strings.SplitN(v, ":", 2); len(parts) == 2 {
+			version.Version, version.Status = parts[0], parts[1]
+		}
+		d.Embedded.Versions = append(d.Embedded.Versions, version)
+	}
+	return d
+}
+
+func TestValidateDatabase(t *testing.T) {
+	databases := []composeapi.Database{
+		database("mongodb", "3.2.11", "3.4.1", "3.0.12:deprecated"),
+		database("postgresql", "9.5.5", "9.6.1"),
+		database("retired", "1.0:deprecated"),
+	}
+
+	tests := []struct {
+		name         string
+		databasetype string
+		version      string
+		errs         []string
+	}{
+		{"type and version", "postgresql", "9.6.1", []string{}},
+		{"type only", "mongodb", "", []string{}},
+		{"deprecated version", "mongodb", "3.0.12", []string{"mongodb version 3.0.12 is deprecated"}},
+		{"no versions available", "retired", "", []string{"retired has no versions available"}},
+		{"version near miss", "postgresql", "9.6.2", []string{`unknown postgresql version "9.6.2", did you mean "9.6.1"?`}},
+		{"version with nothing close", "postgresql", "10", []string{`unknown postgresql version "10" (one of 9.5.5, 9.6.1)`}},
+		{"type near miss", "postgres", "", []string{`unknown deployment type "postgres", did you mean "postgresql"?`}},
+		{"type case", "MongoDB", "", []string{`unknown deployment type "MongoDB", did you mean "mongodb"?`}},
+		{"type with nothing close", "elasticsearch", "", []string{`unknown deployment type "elasticsearch" (one of mongodb, postgresql, retired)`}},
+		{"no type", "", "", []string{"deployment type is required (one of mongodb, postgresql, retired)"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs := []string{}
+			for _, v := range validateDatabase(test.databasetype, test.version, databases) {
+				errs = append(errs, v.Error())
+			}
+			if !reflect.DeepEqual(errs, test.errs) {
+				t.Errorf("errors %q, want %q", errs, test.errs)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	datacenters := []string{"aws:us-east-1", "aws:eu-west-1", "gce:us-central1", "softlayer:dallas-1"}
+
+	tests := []struct {
+		value      string
+		candidates []string
+		want       string
+	}{
+		{"aws:us-east-1", datacenters, "aws:us-east-1"},
+		{"aws:us-east1", datacenters, "aws:us-east-1"},
+		{"aws:eu-west-2", datacenters, "aws:eu-west-1"},
+		{"AWS:US-EAST-1", datacenters, "aws:us-east-1"},
+		{"softlayer:dallas", datacenters, "softlayer:dallas-1"},
+		{"azure:westeurope", datacenters, ""},
+		{"x", datacenters, ""},
+		{"redis", []string{"mongodb", "postgresql", "redis", "rethink"}, "redis"},
+		{"rethinkdb", []string{"mongodb", "postgresql", "redis", "rethink"}, "rethink"},
+		{"mysql", []string{"mongodb", "postgresql", "redis", "rethink"}, ""},
+		{"anything", nil, ""},
+	}
+
+	for _, test := range tests {
+		if got := suggest(test.value, test.candidates); got != test.want {
+			t.Errorf("suggest(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}